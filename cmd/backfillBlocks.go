@@ -11,15 +11,26 @@ var backfillBlocksCmd = &cobra.Command{
 	Use:   "backfill-blocks",
 	Short: "Backfills block data from the chia RPC into the metrics database",
 	Run: func(cmd *cobra.Command, args []string) {
-		mets := newMetsHelper()
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+
+		if path := viper.GetString("from-node-db"); path != "" {
+			cobra.CheckErr(mets.OpenNodeDB(path))
+			defer func() {
+				err := mets.CloseNodeDB()
+				if err != nil {
+					log.Errorf("Error closing the full node database: %s\n", err.Error())
+				}
+			}()
+		}
 
 		if viper.GetBool("delete-first") {
 			log.Println("Deleting block records")
-			cobra.CheckErr(mets.DeleteBlockRecords())
-			cobra.CheckErr(mets.BackfillBlocks())
+			cobra.CheckErr(mets.DeleteBlockRecords(ctx))
+			cobra.CheckErr(mets.BackfillBlocks(ctx, viper.GetInt("backfill-workers")))
 		} else {
-			cobra.CheckErr(mets.FillBlockGaps())
-			cobra.CheckErr(mets.BackfillBlocks())
+			cobra.CheckErr(mets.FillBlockGaps(ctx))
+			cobra.CheckErr(mets.BackfillBlocks(ctx, viper.GetInt("backfill-workers")))
 		}
 	},
 }
@@ -27,10 +38,13 @@ var backfillBlocksCmd = &cobra.Command{
 func init() {
 	var (
 		deleteFirst bool
+		fromNodeDB  string
 	)
 
 	rootCmd.AddCommand(backfillBlocksCmd)
 
 	backfillBlocksCmd.Flags().BoolVar(&deleteFirst, "delete-first", false, "Whether or not to delete the content of the table before importing")
+	backfillBlocksCmd.Flags().StringVar(&fromNodeDB, "from-node-db", "", "Path to a copy of the full node's v2 blockchain database to read blocks from, instead of the RPC")
 	cobra.CheckErr(viper.BindPFlag("delete-first", backfillBlocksCmd.Flags().Lookup("delete-first")))
+	cobra.CheckErr(viper.BindPFlag("from-node-db", backfillBlocksCmd.Flags().Lookup("from-node-db")))
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/chia-network/block-metrics/internal/metrics"
+)
+
+// entitiesCmd represents the entities command
+var entitiesCmd = &cobra.Command{
+	Use:   "entities",
+	Short: "Manages the registry of entities that operate several farmer addresses",
+	Long: "Manages the entities-file, which maps farmer addresses to the entity that operates them. " +
+		"The entity aware NC counts the addresses of each entity as a single farmer",
+}
+
+// entitiesListCmd represents the entities list command
+var entitiesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists every entity and its addresses",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := loadEntityRegistry(false)
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, err := fmt.Fprintln(writer, "ENTITY\tADDRESS")
+		cobra.CheckErr(err)
+		for _, entity := range registry.Entities() {
+			for _, address := range entity.Addresses {
+				_, err = fmt.Fprintf(writer, "%s\t%s\n", entity.Name, address)
+				cobra.CheckErr(err)
+			}
+		}
+		cobra.CheckErr(writer.Flush())
+	},
+}
+
+// entitiesAddCmd represents the entities add command
+var entitiesAddCmd = &cobra.Command{
+	Use:   "add <entity> <address>...",
+	Short: "Maps the addresses to the entity, creating the entities-file if it doesn't exist",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := loadEntityRegistry(true)
+		for _, address := range args[1:] {
+			cobra.CheckErr(registry.Set(address, args[0]))
+		}
+		cobra.CheckErr(registry.Save(viper.GetString("entities-file")))
+	},
+}
+
+// entitiesRemoveCmd represents the entities remove command
+var entitiesRemoveCmd = &cobra.Command{
+	Use:   "remove <address>...",
+	Short: "Removes the addresses from the registry",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := loadEntityRegistry(false)
+		for _, address := range args {
+			if !registry.Remove(address) {
+				cobra.CheckErr(fmt.Errorf("address %s is not in the registry", address))
+			}
+		}
+		cobra.CheckErr(registry.Save(viper.GetString("entities-file")))
+	},
+}
+
+// loadEntityRegistry loads the configured entities-file. If create is true, a missing file is treated as an empty registry
+func loadEntityRegistry(create bool) *metrics.EntityRegistry {
+	path := viper.GetString("entities-file")
+	if path == "" {
+		cobra.CheckErr(fmt.Errorf("entities-file must be set to manage entities"))
+	}
+
+	registry, err := metrics.LoadEntityRegistry(path)
+	if create && errors.Is(err, fs.ErrNotExist) {
+		return metrics.NewEntityRegistry()
+	}
+	cobra.CheckErr(err)
+
+	return registry
+}
+
+func init() {
+	entitiesCmd.AddCommand(entitiesListCmd)
+	entitiesCmd.AddCommand(entitiesAddCmd)
+	entitiesCmd.AddCommand(entitiesRemoveCmd)
+
+	rootCmd.AddCommand(entitiesCmd)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the blocks in the metrics database to a portable NDJSON or Parquet archive",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+
+		path := viper.GetString("export-output")
+		count, err := mets.ExportBlocks(ctx, path, viper.GetString("export-format"), viper.GetUint32("export-from"), viper.GetUint32("export-to"))
+		cobra.CheckErr(err)
+
+		log.Printf("Exported %d blocks to %s\n", count, path)
+	},
+}
+
+func init() {
+	var (
+		output     string
+		format     string
+		fromHeight uint32
+		toHeight   uint32
+	)
+
+	exportCmd.Flags().StringVar(&output, "output", "blocks.ndjson.zst", "The archive file to write. NDJSON paths ending in .zst are zstd compressed and paths ending in .gz are gzip compressed")
+	exportCmd.Flags().StringVar(&format, "format", "", "The archive format, ndjson or parquet. Defaults to parquet for paths ending in .parquet, and ndjson otherwise")
+	exportCmd.Flags().Uint32Var(&fromHeight, "from", 0, "The lowest block height to export")
+	exportCmd.Flags().Uint32Var(&toHeight, "to", 0, "The highest block height to export. 0 exports up to the newest block")
+
+	// The keys are prefixed, so they don't collide with the flags of the same name on import
+	cobra.CheckErr(viper.BindPFlag("export-output", exportCmd.Flags().Lookup("output")))
+	cobra.CheckErr(viper.BindPFlag("export-format", exportCmd.Flags().Lookup("format")))
+	cobra.CheckErr(viper.BindPFlag("export-from", exportCmd.Flags().Lookup("from")))
+	cobra.CheckErr(viper.BindPFlag("export-to", exportCmd.Flags().Lookup("to")))
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -1,115 +1,344 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/chia-network/block-metrics/internal/metrics"
 )
 
 // historicalOutputCmd represents the historicalOutput command
 var historicalOutputCmd = &cobra.Command{
 	Use:   "historical-output",
-	Short: "Generates a CSV of historical NC data",
+	Short: "Generates a CSV, JSON, NDJSON, or Parquet file of historical NC data",
 	Run: func(cmd *cobra.Command, args []string) {
-		mets := newMetsHelper()
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
 
-		oldest, err := mets.GetOldestBlock()
+		oldest, err := mets.GetOldestBlock(ctx)
 		if err != nil {
 			log.Printf("Error getting oldest block: %s\n", err.Error())
 			return
 		}
 		log.Printf("Oldest block in the DB is %d\n", oldest)
 
-		newest, err := mets.GetNewestBlock()
+		newest, err := mets.GetNewestBlock(ctx)
 		if err != nil {
 			log.Printf("Error getting newest block: %s\n", err.Error())
 			return
 		}
 		log.Printf("Newest block in the DB is %d\n", newest)
 
-		startBlock := oldest + mets.LookbackWindow()
-		log.Printf("Starting historical data at block %d\n", startBlock)
-
-		file, err := os.Create("history.csv")
-		if err != nil {
-			log.Fatalln(err.Error())
+		// Start once the largest window is full, so every column has a value
+		var largestWindow uint32
+		for _, window := range mets.LookbackWindows() {
+			largestWindow = max(largestWindow, window)
 		}
+		startBlock := oldest + largestWindow
 
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
+		fromHeight, err := historyBound(ctx, mets, viper.GetString("historical-from"), true)
+		cobra.CheckErr(err)
+		startBlock = max(startBlock, fromHeight)
 
-		err = writer.Write([]string{"height", "date", "nc50", "nc51", "nc50adj", "nc51adj"})
-		if err != nil {
-			log.Fatalln(err.Error())
+		var toHeight uint32
+		hasTo := viper.GetString("historical-to") != ""
+		if hasTo {
+			toHeight, err = historyBound(ctx, mets, viper.GetString("historical-to"), false)
+			cobra.CheckErr(err)
+			newest = min(newest, toHeight)
 		}
+		if newest < startBlock {
+			log.Printf("No heights to output. The range ends at %d, before the first height with full windows, %d\n", newest, startBlock)
+			return
+		}
+		log.Printf("Starting historical data at block %d\n", startBlock)
 
-		bar := progressbar.Default(int64(newest - startBlock))
-
-		interval := viper.GetUint32("interval")
-		for {
-			newestBlock, err := mets.GetNewestBlock()
-			if err != nil {
-				log.Printf("Error getting newest block: %s\n", err.Error())
-				return
-			}
-			if newestBlock < startBlock {
-				break
+		header := []string{"height", "date"}
+		for _, window := range mets.LookbackWindows() {
+			header = appendNakamotoHeader(header, mets, windowColumnSuffix(window, mets.LookbackWindow()))
+		}
+		for _, duration := range mets.LookbackDurations() {
+			header = appendNakamotoHeader(header, mets, duration.Label)
+		}
+		if mets.HasEntities() {
+			for _, adjusted := range []bool{false, true} {
+				for _, threshold := range mets.NakamotoThresholds() {
+					header = append(header, entityNakamotoColumn(threshold, adjusted))
+				}
 			}
+		}
+		header = append(header,
+			"gini", "hhi", "shannon", "effective_farmers", "theil",
+			"gini_adj", "hhi_adj", "shannon_adj", "effective_farmers_adj", "theil_adj",
+		)
+		columns, err := selectColumns(header, viper.GetStringSlice("historical-columns"))
+		cobra.CheckErr(err)
+
+		writer, err := newHistoryWriter(viper.GetString("historical-output"), viper.GetString("historical-format"))
+		cobra.CheckErr(err)
 
-			nc50, err := mets.CalculateNakamoto(startBlock, 50, []string{})
+		// The rows are written by a func, so the writer is always closed before exiting, even on an error. Otherwise
+		// buffered rows would be lost, and a parquet file would be left without its footer
+		writeRows := func() error {
+			err := writer.WriteHeader(pickColumns(header, columns))
 			if err != nil {
-				log.Printf("Error calculating 50%% NC for peak %d: %s\n", startBlock, err.Error())
+				return err
 			}
-			nc51, err := mets.CalculateNakamoto(startBlock, 51, []string{})
-			if err != nil {
-				log.Printf("Error calculating 51%% NC for peak %d: %s\n", startBlock, err.Error())
+
+			// The single pass sweep calculates the same metrics from in memory windows, instead of aggregating every window
+			// in the DB at every height
+			var calculator historyCalculator = mets
+			if viper.GetBool("single-pass") {
+				log.Println("Calculating the history in a single pass over the blocks")
+				calculator = mets.NewHistorySweep()
 			}
 
-			nc50adj, err := mets.CalculateNakamoto(startBlock, 50, viper.GetStringSlice("adjusted-ignore-addresses"))
-			if err != nil {
-				log.Printf("Error calculating adjusted 50%% NC for peak %d: %s\n", startBlock, err.Error())
+			bar := progressbar.Default(int64(newest - startBlock))
+
+			interval := viper.GetUint32("interval")
+			for {
+				if ctx.Err() != nil {
+					log.Println("Stopping early. The output has every row up to this point")
+					break
+				}
+
+				newestBlock, err := mets.GetNewestBlock(ctx)
+				if err != nil {
+					return fmt.Errorf("error getting newest block: %w", err)
+				}
+				if newestBlock < startBlock || (hasTo && startBlock > toHeight) {
+					break
+				}
+
+				timestamp := mets.GetNonTXBlockTimestamp(ctx, startBlock)
+				var date string
+				if timestamp.Valid {
+					date = timestamp.Time.Format("2006-01-02 15:04:05")
+				}
+
+				row := []string{fmt.Sprintf("%d", startBlock), date}
+				for _, window := range mets.LookbackWindows() {
+					row = appendNakamotoColumns(ctx, row, mets, calculator, startBlock, window, windowColumnSuffix(window, mets.LookbackWindow()))
+				}
+				for _, duration := range mets.LookbackDurations() {
+					// The window covers the blocks with timestamps within the duration before this block
+					var window uint32
+					peakTime, err := mets.GetBlockTimestamp(ctx, startBlock)
+					if err == nil {
+						window, err = mets.LookbackWindowSince(ctx, startBlock, peakTime.Add(-duration.Duration))
+					}
+					if err != nil {
+						log.Printf("Error resolving the %s lookback window for peak %d: %s\n", duration.Label, startBlock, err.Error())
+					}
+					row = appendNakamotoColumns(ctx, row, mets, calculator, startBlock, window, duration.Label)
+				}
+
+				if mets.HasEntities() {
+					row = appendEntityNakamotoColumns(ctx, row, mets, calculator, startBlock)
+				}
+
+				indices, err := calculator.CalculateIndices(ctx, startBlock, []string{})
+				if err != nil {
+					log.Printf("Error calculating decentralization indices for peak %d: %s\n", startBlock, err.Error())
+				}
+				indicesAdj, err := calculator.CalculateIndices(ctx, startBlock, mets.AdjustedIgnoreAddresses())
+				if err != nil {
+					log.Printf("Error calculating adjusted decentralization indices for peak %d: %s\n", startBlock, err.Error())
+				}
+
+				row = append(row,
+					formatIndex(indices.Gini),
+					formatIndex(indices.HHI),
+					formatIndex(indices.Shannon),
+					formatIndex(indices.EffectiveFarmers),
+					formatIndex(indices.Theil),
+					formatIndex(indicesAdj.Gini),
+					formatIndex(indicesAdj.HHI),
+					formatIndex(indicesAdj.Shannon),
+					formatIndex(indicesAdj.EffectiveFarmers),
+					formatIndex(indicesAdj.Theil),
+				)
+				err = writer.WriteRow(pickColumns(row, columns))
+				if err != nil {
+					return err
+				}
+				startBlock += interval
+				err = bar.Add(int(interval))
+				_ = err
 			}
-			nc51adj, err := mets.CalculateNakamoto(startBlock, 51, viper.GetStringSlice("adjusted-ignore-addresses"))
-			if err != nil {
-				log.Printf("Error calculating adjusted 51%% NC for peak %d: %s\n", startBlock, err.Error())
+
+			return bar.Finish()
+		}
+		err = writeRows()
+		closeErr := writer.Close()
+		if closeErr != nil {
+			closeErr = fmt.Errorf("error finishing the output: %w", closeErr)
+		}
+		cobra.CheckErr(errors.Join(err, closeErr))
+
+		log.Println("Complete!")
+	},
+}
+
+// historyCalculator calculates the metrics for each row. Implemented by the metrics, which aggregate the windows in the
+// DB, and by the single pass metrics.HistorySweep
+type historyCalculator interface {
+	CalculateNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error)
+	CalculateEntityNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error)
+	CalculateIndices(ctx context.Context, peakHeight uint32, ignoreAddresses []string) (metrics.DecentralizationIndices, error)
+}
+
+// nakamotoColumn returns the CSV column name for the NC. Columns for the lookback-window keep the original nc50 style
+// names, and the other windows have the window appended
+func nakamotoColumn(threshold int, adjusted bool, window string) string {
+	column := fmt.Sprintf("nc%d", threshold)
+	if adjusted {
+		column += "adj"
+	}
+	if window != "" {
+		column += "_" + window
+	}
+	return column
+}
+
+// appendNakamotoHeader appends the column names that match appendNakamotoColumns to the header
+func appendNakamotoHeader(header []string, mets *metrics.Metrics, label string) []string {
+	for _, adjusted := range []bool{false, true} {
+		for _, threshold := range mets.NakamotoThresholds() {
+			header = append(header, nakamotoColumn(threshold, adjusted, label))
+		}
+	}
+	return header
+}
+
+// appendNakamotoColumns appends the NC for each threshold, then the adjusted NC for each threshold, to the row
+// A window of 0 means the window couldn't be resolved, so the columns are left at 0
+func appendNakamotoColumns(ctx context.Context, row []string, mets *metrics.Metrics, calculator historyCalculator, peakHeight uint32, window uint32, label string) []string {
+	for _, adjusted := range []bool{false, true} {
+		ignoreAddresses := []string{}
+		if adjusted {
+			ignoreAddresses = mets.AdjustedIgnoreAddresses()
+		}
+		for _, threshold := range mets.NakamotoThresholds() {
+			var nc int
+			if window > 0 {
+				var err error
+				nc, err = calculator.CalculateNakamotoForWindow(ctx, peakHeight, window, threshold, ignoreAddresses)
+				if err != nil {
+					log.Printf("Error calculating %s NC for peak %d: %s\n", nakamotoColumn(threshold, adjusted, label), peakHeight, err.Error())
+				}
 			}
+			row = append(row, fmt.Sprintf("%d", nc))
+		}
+	}
+	return row
+}
+
+// entityNakamotoColumn returns the CSV column name for the entity aware NC, such as nc50entity or nc50entityadj
+func entityNakamotoColumn(threshold int, adjusted bool) string {
+	column := fmt.Sprintf("nc%dentity", threshold)
+	if adjusted {
+		column += "adj"
+	}
+	return column
+}
 
-			timestamp := mets.GetNonTXBlockTimestamp(startBlock)
-			err = writer.Write([]string{
-				fmt.Sprintf("%d", startBlock),
-				timestamp.String,
-				fmt.Sprintf("%d", nc50),
-				fmt.Sprintf("%d", nc51),
-				fmt.Sprintf("%d", nc50adj),
-				fmt.Sprintf("%d", nc51adj),
-			})
+// appendEntityNakamotoColumns appends the entity aware NC for each threshold, then the adjusted entity aware NC for each
+// threshold, for the lookback-window to the row
+func appendEntityNakamotoColumns(ctx context.Context, row []string, mets *metrics.Metrics, calculator historyCalculator, peakHeight uint32) []string {
+	for _, adjusted := range []bool{false, true} {
+		ignoreAddresses := []string{}
+		if adjusted {
+			ignoreAddresses = mets.AdjustedIgnoreAddresses()
+		}
+		for _, threshold := range mets.NakamotoThresholds() {
+			nc, err := calculator.CalculateEntityNakamotoForWindow(ctx, peakHeight, mets.LookbackWindow(), threshold, ignoreAddresses)
 			if err != nil {
-				log.Fatalln(err.Error())
+				log.Printf("Error calculating %s NC for peak %d: %s\n", entityNakamotoColumn(threshold, adjusted), peakHeight, err.Error())
 			}
-			startBlock += interval
-			err = bar.Add(int(interval))
-			_ = err
+			row = append(row, fmt.Sprintf("%d", nc))
 		}
+	}
+	return row
+}
 
-		err = bar.Finish()
-		cobra.CheckErr(err)
+// windowColumnSuffix returns the column suffix for the block count lookback window
+func windowColumnSuffix(window uint32, lookbackWindow uint32) string {
+	if window == lookbackWindow {
+		return ""
+	}
+	return fmt.Sprintf("%d", window)
+}
 
-		log.Println("Complete!")
-	},
+// historyBound resolves a --from or --to value to a height. The value is either a height, or a date or RFC 3339
+// timestamp in UTC. A from time starts at the first block at or after the time, and a to time ends at the last block at
+// or before the time
+func historyBound(ctx context.Context, mets *metrics.Metrics, value string, from bool) (uint32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if height, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return uint32(height), nil
+	}
+
+	timestamp, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		timestamp, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid height or time %s. Must be a height, a date such as 2024-01-31, or an RFC 3339 timestamp", value)
+	}
+
+	if !from {
+		return mets.GetHeightAtTime(ctx, timestamp)
+	}
+	// Without any blocks before the time, the output starts at the oldest block
+	height, err := mets.GetHeightAtTime(ctx, timestamp.Add(-time.Nanosecond))
+	if err != nil {
+		return 0, nil
+	}
+	return height + 1, nil
+}
+
+func formatIndex(index float64) string {
+	return strconv.FormatFloat(index, 'f', 6, 64)
 }
 
 func init() {
 	var (
 		interval uint32
+		output   string
+		format   string
+		from     string
+		to       string
+		columns  []string
+		single   bool
 	)
 
 	historicalOutputCmd.PersistentFlags().Uint32Var(&interval, "interval", 100, "How many blocks between calculating the NC")
+	historicalOutputCmd.PersistentFlags().StringVar(&output, "output", "history.csv", "The file to write, or - for stdout")
+	historicalOutputCmd.PersistentFlags().StringVar(&format, "format", "csv", "The output format. One of csv, json, ndjson, parquet. parquet can't be written to stdout")
+	historicalOutputCmd.PersistentFlags().StringVar(&from, "from", "", "The first height, date, or RFC 3339 timestamp to output")
+	historicalOutputCmd.PersistentFlags().StringVar(&to, "to", "", "The last height, date, or RFC 3339 timestamp to output")
+	historicalOutputCmd.PersistentFlags().StringSliceVar(&columns, "columns", nil, "The columns to output, in order. Defaults to every column")
+	historicalOutputCmd.PersistentFlags().BoolVar(&single, "single-pass", false, "Whether to calculate the history in a single pass over the blocks, instead of querying every window at every height")
 	cobra.CheckErr(viper.BindPFlag("interval", historicalOutputCmd.PersistentFlags().Lookup("interval")))
+	cobra.CheckErr(viper.BindPFlag("single-pass", historicalOutputCmd.PersistentFlags().Lookup("single-pass")))
+
+	// The keys are prefixed, so they don't collide with the flags of the same name on export and import
+	cobra.CheckErr(viper.BindPFlag("historical-output", historicalOutputCmd.PersistentFlags().Lookup("output")))
+	cobra.CheckErr(viper.BindPFlag("historical-format", historicalOutputCmd.PersistentFlags().Lookup("format")))
+	cobra.CheckErr(viper.BindPFlag("historical-from", historicalOutputCmd.PersistentFlags().Lookup("from")))
+	cobra.CheckErr(viper.BindPFlag("historical-to", historicalOutputCmd.PersistentFlags().Lookup("to")))
+	cobra.CheckErr(viper.BindPFlag("historical-columns", historicalOutputCmd.PersistentFlags().Lookup("columns")))
 
 	rootCmd.AddCommand(historicalOutputCmd)
 }
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chia-network/block-metrics/internal/parquet"
+)
+
+// historyFormats are the formats historical-output can write
+var historyFormats = []string{"csv", "json", "ndjson", "parquet"}
+
+// historyWriter writes the historical-output rows in one of the historyFormats
+type historyWriter interface {
+	// WriteHeader writes the column names. It is called once, before any rows
+	WriteHeader(columns []string) error
+	// WriteRow writes a row with a value for each column
+	WriteRow(row []string) error
+	// Close finishes the output and flushes anything buffered
+	Close() error
+}
+
+// newHistoryWriter returns the writer for the format, writing to the path, or stdout if the path is -
+func newHistoryWriter(path string, format string) (historyWriter, error) {
+	if !slices.Contains(historyFormats, format) {
+		return nil, fmt.Errorf("unsupported format %s. Must be one of %s", format, strings.Join(historyFormats, ", "))
+	}
+	// The parquet footer is written last and points back at the data, so it needs a file
+	if format == "parquet" && path == "-" {
+		return nil, fmt.Errorf("the parquet format can't be written to stdout. Set --output to a file")
+	}
+
+	output := io.WriteCloser(os.Stdout)
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		output = file
+	}
+
+	switch format {
+	case "json":
+		return &jsonHistoryWriter{output: output, buffered: bufio.NewWriter(output), array: true}, nil
+	case "ndjson":
+		return &jsonHistoryWriter{output: output, buffered: bufio.NewWriter(output)}, nil
+	case "parquet":
+		return &parquetHistoryWriter{output: output, buffered: bufio.NewWriter(output)}, nil
+	default:
+		return &csvHistoryWriter{output: output, writer: csv.NewWriter(output)}, nil
+	}
+}
+
+// csvHistoryWriter writes a header row followed by a row per height
+type csvHistoryWriter struct {
+	output io.WriteCloser
+	writer *csv.Writer
+}
+
+func (w *csvHistoryWriter) WriteHeader(columns []string) error {
+	return w.writer.Write(columns)
+}
+
+func (w *csvHistoryWriter) WriteRow(row []string) error {
+	return w.writer.Write(row)
+}
+
+func (w *csvHistoryWriter) Close() error {
+	w.writer.Flush()
+	return closeHistoryOutput(w.output, w.writer.Error())
+}
+
+// jsonHistoryWriter writes an object per height, keyed by column name, in the column order
+// The objects are in a single array for json, or one per line for ndjson. The date is a string, or null for heights
+// without a timestamp, and every other column is a number, or null if it isn't a finite number
+type jsonHistoryWriter struct {
+	output   io.WriteCloser
+	buffered *bufio.Writer
+	array    bool
+	columns  []string
+	rows     int
+}
+
+func (w *jsonHistoryWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	if w.array {
+		_, err := w.buffered.WriteString("[\n")
+		return err
+	}
+	return nil
+}
+
+func (w *jsonHistoryWriter) WriteRow(row []string) error {
+	if w.array && w.rows > 0 {
+		_, err := w.buffered.WriteString(",\n")
+		if err != nil {
+			return err
+		}
+	}
+	w.rows++
+
+	var object strings.Builder
+	object.WriteString("{")
+	for i, column := range w.columns {
+		if i > 0 {
+			object.WriteString(",")
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		object.Write(key)
+		object.WriteString(":")
+
+		switch {
+		case column == "date" && row[i] == "", column != "date" && !isJSONNumber(row[i]):
+			object.WriteString("null")
+		case column == "date":
+			value, err := json.Marshal(row[i])
+			if err != nil {
+				return err
+			}
+			object.Write(value)
+		default:
+			object.WriteString(row[i])
+		}
+	}
+	object.WriteString("}")
+	if !w.array {
+		object.WriteString("\n")
+	}
+
+	_, err := w.buffered.WriteString(object.String())
+	return err
+}
+
+func (w *jsonHistoryWriter) Close() error {
+	var err error
+	if w.array {
+		if w.rows > 0 {
+			_, err = w.buffered.WriteString("\n")
+		}
+		if err == nil {
+			_, err = w.buffered.WriteString("]\n")
+		}
+	}
+	if err == nil {
+		err = w.buffered.Flush()
+	}
+	return closeHistoryOutput(w.output, err)
+}
+
+// parquetHistoryWriter writes a row per height, with a column for each column name
+// The height is an int64, the date is a UTC timestamp, or null for heights without a timestamp, and every other column is
+// a double, or null if it isn't a finite number
+type parquetHistoryWriter struct {
+	output   io.WriteCloser
+	buffered *bufio.Writer
+	writer   *parquet.Writer
+	columns  []parquet.Column
+}
+
+func (w *parquetHistoryWriter) WriteHeader(columns []string) error {
+	for _, column := range columns {
+		switch column {
+		case "height":
+			w.columns = append(w.columns, parquet.Column{Name: column, Kind: parquet.Int64})
+		case "date":
+			w.columns = append(w.columns, parquet.Column{Name: column, Kind: parquet.Timestamp, Optional: true})
+		default:
+			w.columns = append(w.columns, parquet.Column{Name: column, Kind: parquet.Double, Optional: true})
+		}
+	}
+
+	var err error
+	w.writer, err = parquet.NewWriter(w.buffered, w.columns, nil)
+	return err
+}
+
+func (w *parquetHistoryWriter) WriteRow(row []string) error {
+	values := make([]any, len(row))
+	for i, column := range w.columns {
+		switch column.Kind {
+		case parquet.Int64:
+			height, err := strconv.ParseInt(row[i], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid height %s: %w", row[i], err)
+			}
+			values[i] = height
+		case parquet.Timestamp:
+			if row[i] == "" {
+				continue
+			}
+			date, err := time.ParseInLocation(time.DateTime, row[i], time.UTC)
+			if err != nil {
+				return fmt.Errorf("invalid date %s: %w", row[i], err)
+			}
+			values[i] = date
+		default:
+			if isJSONNumber(row[i]) {
+				values[i], _ = strconv.ParseFloat(row[i], 64)
+			}
+		}
+	}
+
+	return w.writer.Write(values)
+}
+
+func (w *parquetHistoryWriter) Close() error {
+	var err error
+	if w.writer != nil {
+		err = w.writer.Close()
+	}
+	if err == nil {
+		err = w.buffered.Flush()
+	}
+	return closeHistoryOutput(w.output, err)
+}
+
+// isJSONNumber returns whether the value can be written to JSON as a number, which NaN and infinite values can't
+func isJSONNumber(value string) bool {
+	number, err := strconv.ParseFloat(value, 64)
+	return err == nil && !math.IsNaN(number) && !math.IsInf(number, 0)
+}
+
+// closeHistoryOutput closes the output file, unless it's stdout, and returns the first error
+func closeHistoryOutput(output io.WriteCloser, err error) error {
+	if output == os.Stdout {
+		return err
+	}
+	closeErr := output.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// selectColumns returns the indexes of the selected columns in the header, in the order they were selected. Every
+// column is selected if none are given
+func selectColumns(header []string, selected []string) ([]int, error) {
+	if len(selected) == 0 {
+		indexes := make([]int, len(header))
+		for i := range header {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	for _, column := range selected {
+		index := slices.Index(header, column)
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column %s. Available columns are %s", column, strings.Join(header, ", "))
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// pickColumns returns the values at the indexes
+func pickColumns(values []string, indexes []int) []string {
+	picked := make([]string, len(indexes))
+	for i, index := range indexes {
+		picked[i] = values[index]
+	}
+	return picked
+}
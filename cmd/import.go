@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <archive>",
+	Short: "Imports the blocks from an NDJSON or Parquet archive created by export into the metrics database",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+
+		count, err := mets.ImportBlocks(ctx, args[0], viper.GetUint32("import-from"), viper.GetUint32("import-to"))
+		cobra.CheckErr(err)
+
+		log.Printf("Imported %d blocks from %s\n", count, args[0])
+	},
+}
+
+func init() {
+	var (
+		fromHeight uint32
+		toHeight   uint32
+	)
+
+	importCmd.Flags().Uint32Var(&fromHeight, "from", 0, "The lowest block height to import")
+	importCmd.Flags().Uint32Var(&toHeight, "to", 0, "The highest block height to import. 0 imports up to the last block in the archive")
+
+	// The keys are prefixed, so they don't collide with the flags of the same name on export
+	cobra.CheckErr(viper.BindPFlag("import-from", importCmd.Flags().Lookup("from")))
+	cobra.CheckErr(viper.BindPFlag("import-to", importCmd.Flags().Lookup("to")))
+
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manages the database schema migrations",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// The migrate commands manage migrations explicitly, so they should never be applied automatically on startup,
+		// and pending migrations aren't an error
+		viper.Set("auto-migrate", false)
+		viper.Set("allow-pending-migrations", true)
+	},
+}
+
+// migrateUpCmd represents the migrate up command
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Applies all pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+		cobra.CheckErr(mets.MigrateUp(ctx))
+	},
+}
+
+// migrateDownCmd represents the migrate down command
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Rolls back the most recently applied migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+		cobra.CheckErr(mets.MigrateDown(ctx, viper.GetInt("steps")))
+	},
+}
+
+// migrateStatusCmd represents the migrate status command
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows which migrations have been applied to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+		statuses, err := mets.MigrationStatus(ctx)
+		cobra.CheckErr(err)
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, err = fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		cobra.CheckErr(err)
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			_, err = fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			cobra.CheckErr(err)
+		}
+		cobra.CheckErr(writer.Flush())
+	},
+}
+
+func init() {
+	var (
+		steps int
+	)
+
+	migrateDownCmd.Flags().IntVar(&steps, "steps", 1, "How many migrations to roll back")
+	cobra.CheckErr(viper.BindPFlag("steps", migrateDownCmd.Flags().Lookup("steps")))
+
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
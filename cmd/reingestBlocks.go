@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reingestBlocksCmd represents the reingest-blocks command
+var reingestBlocksCmd = &cobra.Command{
+	Use:   "reingest-blocks",
+	Short: "Fetches blocks already in the metrics database from the chia RPC again, to fill in the block details",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+
+		cobra.CheckErr(mets.ReingestBlocks(ctx, viper.GetInt("backfill-workers"), viper.GetBool("all")))
+	},
+}
+
+func init() {
+	var (
+		all bool
+	)
+
+	reingestBlocksCmd.Flags().BoolVar(&all, "all", false, "Whether to fetch every block in the database again, instead of only the blocks missing details")
+	cobra.CheckErr(viper.BindPFlag("all", reingestBlocksCmd.Flags().Lookup("all")))
+
+	rootCmd.AddCommand(reingestBlocksCmd)
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -16,16 +19,19 @@ var cfgFile string
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "block-metrics",
-	Short: "Stores block data in mysql + exports prometheus style metrics on block data",
-	Long: `Stores block data in mysql + exports prometheus style metrics on block data.
+	Short: "Stores block data in a database + exports prometheus style metrics on block data",
+	Long: `Stores block data in a database (mysql, postgres, or sqlite) + exports prometheus style metrics on block data.
 
-Can both connect mysql to grafana and utilize the additional prometheus metrics generated based on the data in the DB.`,
+Can both connect the database to grafana and utilize the additional prometheus metrics generated based on the data in the DB.`,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// SIGINT and SIGTERM cancel the context the commands run with, so they can stop cleanly
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -33,44 +39,101 @@ func Execute() {
 
 func init() {
 	var (
-		lookbackWindow          int
-		rpcPerPage              int
-		chiaHostname            string
-		metricsPort             int
-		adjustedIgnoreAddresses []string
-
-		dbHost string
-		dbPort int
-		dbUser string
-		dbPass string
-		dbName string
+		lookbackWindow           int
+		rpcPerPage               int
+		backfillWorkers          int
+		chiaHostname             string
+		chiaHostnames            []string
+		nodeConsensusCheck       bool
+		countCoins               bool
+		ingestMode               string
+		metricsPort              int
+		adjustedIgnoreAddresses  []string
+		adjustedIgnoreCategories []string
+		entitiesFile             string
+		labelsFile               string
+		logLevel                 string
+		autoMigrate              bool
+		nakamotoCrossCheck       bool
+		topFarmersCount          int
+		nakamotoThresholds       []int
+		lookbackWindows          []int
+		lookbackDurations        []string
+		transactionWindows       []int
+		apiMaxWindow             int
+
+		dbDriver  string
+		dbHost    string
+		dbPort    int
+		dbSSLMode string
+		dbUser    string
+		dbPass    string
+		dbName    string
 	)
 
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.block-metrics.yaml)")
 
 	rootCmd.PersistentFlags().IntVar(&lookbackWindow, "lookback-window", 32256, "How many blocks to look at when determining metrics such as nakamoto coefficient")
+	rootCmd.PersistentFlags().IntSliceVar(&lookbackWindows, "lookback-windows", []int{}, "Additional lookback windows, in blocks, to calculate the nakamoto coefficient for")
+	rootCmd.PersistentFlags().StringSliceVar(&lookbackDurations, "lookback-durations", []string{}, "Lookback windows defined by time, such as 24h or 7d, to calculate the nakamoto coefficient for")
+	rootCmd.PersistentFlags().IntSliceVar(&nakamotoThresholds, "nakamoto-thresholds", []int{50, 51}, "The percentages of blocks to calculate the nakamoto coefficient for")
+	rootCmd.PersistentFlags().IntSliceVar(&transactionWindows, "transaction-windows", []int{32, 4608}, "The windows, in blocks, to calculate the fee, block fullness and transactions per second metrics for")
 	rootCmd.PersistentFlags().IntVar(&rpcPerPage, "rpc-per-page", 250, "How many results to fetch in each RPC call")
+	rootCmd.PersistentFlags().IntVar(&backfillWorkers, "backfill-workers", 4, "How many pages of blocks to fetch from the full node concurrently when backfilling or re-ingesting")
 	rootCmd.PersistentFlags().StringVar(&chiaHostname, "chia-hostname", "localhost", "The hostname to use when connecting to chia")
+	rootCmd.PersistentFlags().StringSliceVar(&chiaHostnames, "chia-hostnames", []string{}, "The hostnames of several full nodes to connect to, failing over between them. Used instead of chia-hostname when set")
+	rootCmd.PersistentFlags().BoolVar(&nodeConsensusCheck, "node-consensus-check", false, "Whether to compare the header hash of every new peak across the chia-hostnames")
+	rootCmd.PersistentFlags().BoolVar(&countCoins, "count-coins", false, "Whether to count the coins created and spent by every transaction block saved when backfilling, re-ingesting, or filling gaps. Needs a request to the full node per block")
+	rootCmd.PersistentFlags().StringVar(&ingestMode, "ingest-mode", "websocket", "How serve receives new blocks. websocket subscribes through the daemon, poll only needs the full node RPC")
 	// We'll just use 9914 (same as chia-exporter) for now as a default, since they likely won't run on the same hosts
 	rootCmd.PersistentFlags().IntVar(&metricsPort, "metrics-port", 9914, "The port the metrics server binds to")
+	rootCmd.PersistentFlags().IntVar(&apiMaxWindow, "api-max-window", 1000000, "The largest window, in blocks, the JSON API will calculate metrics for")
+	rootCmd.PersistentFlags().BoolVar(&nakamotoCrossCheck, "nakamoto-cross-check", false, "Whether to compare the in memory nakamoto coefficient against the SQL calculation on every block")
+	rootCmd.PersistentFlags().IntVar(&topFarmersCount, "top-farmers-count", 10, "How many of the top farmer addresses to export metrics for")
 	rootCmd.PersistentFlags().StringSliceVar(&adjustedIgnoreAddresses, "adjusted-ignore-addresses", []string{}, "Addresses to ignore when calculating the adjusted NC figures")
+	rootCmd.PersistentFlags().StringSliceVar(&adjustedIgnoreCategories, "adjusted-ignore-categories", []string{}, "Categories of labelled addresses to ignore when calculating the adjusted NC figures, such as dev-fee")
+	rootCmd.PersistentFlags().StringVar(&labelsFile, "labels-file", "", "YAML or JSON file with labels, categories and notes for addresses. Reloaded when it changes")
+	rootCmd.PersistentFlags().StringVar(&entitiesFile, "entities-file", "", "YAML or CSV file mapping farmer addresses to the entity that operates them")
+	rootCmd.PersistentFlags().StringVar(&dbDriver, "db-driver", "mysql", "The database to store blocks in. One of mysql, postgres, sqlite")
 	rootCmd.PersistentFlags().StringVar(&dbHost, "db-host", "127.0.0.1", "Host or IP address of the DB instance to connect to")
 	rootCmd.PersistentFlags().IntVar(&dbPort, "db-port", 3306, "Port of the database")
 	rootCmd.PersistentFlags().StringVar(&dbUser, "db-user", "root", "The username to use when connecting to the DB")
 	rootCmd.PersistentFlags().StringVar(&dbPass, "db-password", "password", "The password to use when connecting to the DB")
-	rootCmd.PersistentFlags().StringVar(&dbName, "db-name", "blocks", "The name of the database to connect to")
+	rootCmd.PersistentFlags().StringVar(&dbName, "db-name", "blocks", "The name of the database to connect to. For sqlite, this is the path to the database file")
+	rootCmd.PersistentFlags().StringVar(&dbSSLMode, "db-ssl-mode", "disable", "The sslmode to use when connecting to postgres")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "The log level. One of trace, debug, info, warn, error")
+	rootCmd.PersistentFlags().BoolVar(&autoMigrate, "auto-migrate", true, "Whether to apply pending database migrations on startup")
 
 	cobra.CheckErr(viper.BindPFlag("lookback-window", rootCmd.PersistentFlags().Lookup("lookback-window")))
+	cobra.CheckErr(viper.BindPFlag("lookback-windows", rootCmd.PersistentFlags().Lookup("lookback-windows")))
+	cobra.CheckErr(viper.BindPFlag("lookback-durations", rootCmd.PersistentFlags().Lookup("lookback-durations")))
+	cobra.CheckErr(viper.BindPFlag("nakamoto-thresholds", rootCmd.PersistentFlags().Lookup("nakamoto-thresholds")))
+	cobra.CheckErr(viper.BindPFlag("transaction-windows", rootCmd.PersistentFlags().Lookup("transaction-windows")))
 	cobra.CheckErr(viper.BindPFlag("rpc-per-page", rootCmd.PersistentFlags().Lookup("rpc-per-page")))
+	cobra.CheckErr(viper.BindPFlag("backfill-workers", rootCmd.PersistentFlags().Lookup("backfill-workers")))
 	cobra.CheckErr(viper.BindPFlag("chia-hostname", rootCmd.PersistentFlags().Lookup("chia-hostname")))
+	cobra.CheckErr(viper.BindPFlag("chia-hostnames", rootCmd.PersistentFlags().Lookup("chia-hostnames")))
+	cobra.CheckErr(viper.BindPFlag("node-consensus-check", rootCmd.PersistentFlags().Lookup("node-consensus-check")))
+	cobra.CheckErr(viper.BindPFlag("count-coins", rootCmd.PersistentFlags().Lookup("count-coins")))
+	cobra.CheckErr(viper.BindPFlag("ingest-mode", rootCmd.PersistentFlags().Lookup("ingest-mode")))
 	cobra.CheckErr(viper.BindPFlag("metrics-port", rootCmd.PersistentFlags().Lookup("metrics-port")))
+	cobra.CheckErr(viper.BindPFlag("api-max-window", rootCmd.PersistentFlags().Lookup("api-max-window")))
+	cobra.CheckErr(viper.BindPFlag("nakamoto-cross-check", rootCmd.PersistentFlags().Lookup("nakamoto-cross-check")))
+	cobra.CheckErr(viper.BindPFlag("top-farmers-count", rootCmd.PersistentFlags().Lookup("top-farmers-count")))
 	cobra.CheckErr(viper.BindPFlag("adjusted-ignore-addresses", rootCmd.PersistentFlags().Lookup("adjusted-ignore-addresses")))
+	cobra.CheckErr(viper.BindPFlag("adjusted-ignore-categories", rootCmd.PersistentFlags().Lookup("adjusted-ignore-categories")))
+	cobra.CheckErr(viper.BindPFlag("labels-file", rootCmd.PersistentFlags().Lookup("labels-file")))
+	cobra.CheckErr(viper.BindPFlag("entities-file", rootCmd.PersistentFlags().Lookup("entities-file")))
+	cobra.CheckErr(viper.BindPFlag("db-driver", rootCmd.PersistentFlags().Lookup("db-driver")))
 	cobra.CheckErr(viper.BindPFlag("db-host", rootCmd.PersistentFlags().Lookup("db-host")))
 	cobra.CheckErr(viper.BindPFlag("db-port", rootCmd.PersistentFlags().Lookup("db-port")))
 	cobra.CheckErr(viper.BindPFlag("db-user", rootCmd.PersistentFlags().Lookup("db-user")))
 	cobra.CheckErr(viper.BindPFlag("db-password", rootCmd.PersistentFlags().Lookup("db-password")))
 	cobra.CheckErr(viper.BindPFlag("db-name", rootCmd.PersistentFlags().Lookup("db-name")))
+	cobra.CheckErr(viper.BindPFlag("db-ssl-mode", rootCmd.PersistentFlags().Lookup("db-ssl-mode")))
+	cobra.CheckErr(viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level")))
+	cobra.CheckErr(viper.BindPFlag("auto-migrate", rootCmd.PersistentFlags().Lookup("auto-migrate")))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -100,8 +163,9 @@ func initConfig() {
 }
 
 // newMetsHelper returns a new metrics instance pre-filled with config values from Viper
-func newMetsHelper() *metrics.Metrics {
+func newMetsHelper(ctx context.Context) *metrics.Metrics {
 	mets, err := metrics.NewMetrics(
+		ctx,
 		uint16(viper.GetInt("metrics-port")),
 		viper.GetString("db-host"),
 		uint16(viper.GetInt("db-port")),
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -15,21 +17,39 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Starts the metrics server",
 	Run: func(cmd *cobra.Command, args []string) {
-		mets := newMetsHelper()
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+		err := mets.AddNetworks()
+		cobra.CheckErr(err)
 
-		go startWebsocket(mets)
-
-		// Close the websocket when the app is closing
-		// @TODO need to actually listen for a signal and call this then, otherwise it doesn't actually get called
-		defer func(m *metrics.Metrics) {
-			log.Println("App is stopping. Cleaning up...")
-			err := m.CloseWebsocket()
+		// Load the lookback window into memory, so the first block doesn't need to load it
+		// Not fatal, since the DB may still be syncing the block history
+		for _, network := range mets.Networks() {
+			log.Printf("Loading lookback window for %s\n", network.Network().Name)
+			err = network.WarmUpEngine(ctx)
 			if err != nil {
-				log.Errorf("Error closing websocket connection: %s\n", err.Error())
+				log.Errorf("Error loading lookback window for %s: %s\n", network.Network().Name, err.Error())
+			}
+		}
+
+		// Config and label edits apply without a restart
+		mets.WatchConfig()
+		mets.WatchLabels()
+
+		pollInterval := viper.GetDuration("poll-interval")
+		if viper.GetString("ingest-mode") == metrics.IngestModePoll && pollInterval <= 0 {
+			cobra.CheckErr(fmt.Errorf("poll-interval must be greater than 0"))
+		}
+		for _, network := range mets.Networks() {
+			if viper.GetString("ingest-mode") == metrics.IngestModePoll {
+				log.Printf("Polling the %s full nodes for new peaks every %s\n", network.Network().Name, pollInterval)
+				go network.Poll(ctx, pollInterval)
+			} else {
+				go startWebsocket(ctx, network)
 			}
-		}(mets)
+		}
 
-		ignoreAddresses := viper.GetStringSlice("adjusted-ignore-addresses")
+		ignoreAddresses := mets.AdjustedIgnoreAddresses()
 		if len(ignoreAddresses) > 0 {
 			log.Println("Ignoring the following addresses when calculating adjusted NC")
 			for _, _ignore := range ignoreAddresses {
@@ -37,23 +57,62 @@ var serveCmd = &cobra.Command{
 			}
 		}
 
-		log.Fatalln(mets.StartServer())
+		// The server is created before it starts in the background, so shutting down can't miss it
+		mets.SetupServer()
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- mets.StartServer()
+		}()
+
+		var runErr error
+		select {
+		case runErr = <-serverErr:
+			log.Println("Metrics server stopped. Cleaning up...")
+		case <-ctx.Done():
+			log.Println("App is stopping. Cleaning up...")
+		}
+
+		// The command context is already cancelled at this point, so shutdown gets a fresh deadline
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("shutdown-timeout"))
+		defer cancel()
+		err = mets.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Errorf("Error shutting down: %s\n", err.Error())
+		}
+
+		cobra.CheckErr(runErr)
 	},
 }
 
 func init() {
+	var (
+		shutdownTimeout time.Duration
+		pollInterval    time.Duration
+	)
+
+	serveCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait for blocks being processed and metrics requests to finish when stopping")
+	cobra.CheckErr(viper.BindPFlag("shutdown-timeout", serveCmd.Flags().Lookup("shutdown-timeout")))
+
+	serveCmd.Flags().DurationVar(&pollInterval, "poll-interval", 5*time.Second, "How often to check the full nodes for a new peak in the poll ingest-mode")
+	cobra.CheckErr(viper.BindPFlag("poll-interval", serveCmd.Flags().Lookup("poll-interval")))
+
 	rootCmd.AddCommand(serveCmd)
 }
 
-func startWebsocket(m *metrics.Metrics) {
-	// Loop until we get a connection or cancel
+func startWebsocket(ctx context.Context, m *metrics.Metrics) {
+	// Loop until every full node is connected or cancel
 	// This enables starting the metrics exporter even if the chia RPC service is not up/responding
-	// It just retries every 5 seconds to connect to the RPC server until it succeeds or the app is stopped
+	// It just retries every 5 seconds to connect to the nodes that failed until they succeed or the app is stopped
+	// Blocks are received from the nodes that are connected in the meantime
 	for {
 		err := m.OpenWebsocket()
 		if err != nil {
 			log.Errorln(err.Error())
-			time.Sleep(5 * time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
 			continue
 		}
 		break
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// topFarmersCmd represents the top-farmers command
+var topFarmersCmd = &cobra.Command{
+	Use:   "top-farmers",
+	Short: "Shows the farmer addresses that won the most blocks in the lookback window",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		mets := newMetsHelper(ctx)
+
+		height := viper.GetUint32("height")
+		if height == 0 {
+			newest, err := mets.GetNewestBlock(ctx)
+			cobra.CheckErr(err)
+			height = newest
+		}
+
+		ignoreAddresses := []string{}
+		if viper.GetBool("adjusted") {
+			ignoreAddresses = mets.AdjustedIgnoreAddresses()
+		}
+
+		ranks, err := mets.GetTopFarmers(ctx, height, mets.LookbackWindow(), viper.GetInt("top-farmers-count"), ignoreAddresses)
+		cobra.CheckErr(err)
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, err = fmt.Fprintln(writer, "RANK\tFARMER ADDRESS\tBLOCKS\tPERCENT\tLABEL\tCATEGORY")
+		cobra.CheckErr(err)
+		for _, rank := range ranks {
+			_, err = fmt.Fprintf(writer, "%d\t%s\t%d\t%.2f%%\t%s\t%s\n", rank.Rank, rank.FarmerAddress, rank.Blocks, rank.Percent, rank.Label, rank.Category)
+			cobra.CheckErr(err)
+		}
+		cobra.CheckErr(writer.Flush())
+	},
+}
+
+func init() {
+	var (
+		height   uint32
+		adjusted bool
+	)
+
+	topFarmersCmd.Flags().Uint32Var(&height, "height", 0, "The peak height of the lookback window. Defaults to the newest block in the database")
+	topFarmersCmd.Flags().BoolVar(&adjusted, "adjusted", false, "Whether to leave out the adjusted-ignore-addresses and adjusted-ignore-categories")
+	cobra.CheckErr(viper.BindPFlag("height", topFarmersCmd.Flags().Lookup("height")))
+	cobra.CheckErr(viper.BindPFlag("adjusted", topFarmersCmd.Flags().Lookup("adjusted")))
+
+	rootCmd.AddCommand(topFarmersCmd)
+}
@@ -0,0 +1,523 @@
+package metrics
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type nakamotoResponse struct {
+	Height              uint32 `json:"height"`
+	Threshold           int    `json:"threshold"`
+	Window              uint32 `json:"window"`
+	Adjusted            bool   `json:"adjusted"`
+	NakamotoCoefficient int    `json:"nakamoto_coefficient"`
+}
+
+type blockResponse struct {
+	Height           uint32     `json:"height"`
+	Timestamp        *time.Time `json:"timestamp"`
+	TransactionBlock bool       `json:"transaction_block"`
+	FarmerPuzzleHash string     `json:"farmer_puzzle_hash"`
+	FarmerAddress    string     `json:"farmer_address"`
+	HeaderHash       string     `json:"header_hash"`
+	PrevHeaderHash   string     `json:"prev_header_hash"`
+
+	// The block details are omitted for blocks that were saved before they were stored and haven't been re-ingested
+	Weight                 string  `json:"weight,omitempty"`
+	TotalIters             string  `json:"total_iters,omitempty"`
+	SignagePointIndex      *uint8  `json:"signage_point_index,omitempty"`
+	PoolTargetPuzzleHash   string  `json:"pool_target_puzzle_hash,omitempty"`
+	PoolAddress            string  `json:"pool_address,omitempty"`
+	PoolPublicKey          *string `json:"pool_public_key,omitempty"`
+	PoolContractPuzzleHash *string `json:"pool_contract_puzzle_hash,omitempty"`
+	PlotPublicKey          string  `json:"plot_public_key,omitempty"`
+	KSize                  uint8   `json:"k_size,omitempty"`
+
+	// Transactions is omitted for non-transaction blocks, and blocks that haven't been re-ingested
+	Transactions *blockTransactionsResponse `json:"transactions,omitempty"`
+}
+
+type blockTransactionsResponse struct {
+	Fees uint64 `json:"fees"`
+	Cost uint64 `json:"cost"`
+	// Additions and Removals are omitted for blocks saved without counting the coins
+	Additions          *uint32 `json:"additions,omitempty"`
+	Removals           *uint32 `json:"removals,omitempty"`
+	RewardClaims       uint32  `json:"reward_claims"`
+	RewardClaimsAmount uint64  `json:"reward_claims_amount"`
+}
+
+type blocksResponse struct {
+	Blocks []blockResponse `json:"blocks"`
+	// NextFrom is the from value to use to fetch the next page. Omitted on the last page
+	NextFrom *uint32 `json:"next_from,omitempty"`
+}
+
+type farmerResponse struct {
+	Rank          int     `json:"rank"`
+	FarmerAddress string  `json:"farmer_address"`
+	Blocks        uint32  `json:"blocks"`
+	Percent       float64 `json:"percent"`
+	Label         string  `json:"label,omitempty"`
+	Category      string  `json:"category,omitempty"`
+	Notes         string  `json:"notes,omitempty"`
+}
+
+type topFarmersResponse struct {
+	Height   uint32           `json:"height"`
+	Window   uint32           `json:"window"`
+	Adjusted bool             `json:"adjusted"`
+	Farmers  []farmerResponse `json:"farmers"`
+	// NextOffset is the offset value to use to fetch the next page. Omitted on the last page
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+type statusResponse struct {
+	Network        string `json:"network"`
+	OldestBlock    uint32 `json:"oldest_block"`
+	NewestBlock    uint32 `json:"newest_block"`
+	PeakHeight     uint32 `json:"peak_height"`
+	LookbackWindow uint32 `json:"lookback_window"`
+}
+
+// registerAPI adds the JSON API endpoints to the metrics server mux
+func (m *Metrics) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/nakamoto", m.forNetwork((*Metrics).nakamotoEndpoint))
+	mux.HandleFunc("GET /api/v1/blocks", m.forNetwork((*Metrics).blocksEndpoint))
+	mux.HandleFunc("GET /api/v1/farmers/top", m.forNetwork((*Metrics).topFarmersEndpoint))
+	mux.HandleFunc("GET /api/v1/status", m.forNetwork((*Metrics).statusEndpoint))
+}
+
+// forNetwork runs the endpoint with the metrics for the network in the network param
+// Defaults to the first network
+func (m *Metrics) forNetwork(endpoint func(*Metrics, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("network")
+		if name == "" {
+			endpoint(m, w, r)
+			return
+		}
+		for _, network := range m.networks {
+			if network.network.Name == name {
+				endpoint(network, w, r)
+				return
+			}
+		}
+		writeAPIError(w, badRequest(fmt.Errorf("unknown network %s", name)))
+	}
+}
+
+// nakamotoEndpoint returns the NC for the height, threshold, and window
+// Defaults to the newest block, 50% threshold, and the configured lookback window
+func (m *Metrics) nakamotoEndpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	height, window, adjusted, err := m.windowParams(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	threshold, err := intParam(r, "threshold", 50)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if threshold <= 0 || threshold > 100 {
+		writeAPIError(w, badRequest(fmt.Errorf("threshold must be between 1 and 100")))
+		return
+	}
+
+	nakamoto, err := m.CalculateNakamotoForWindow(ctx, height, window, threshold, m.ignoreAddressesFor(adjusted))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, nakamotoResponse{
+		Height:              height,
+		Threshold:           threshold,
+		Window:              window,
+		Adjusted:            adjusted,
+		NakamotoCoefficient: nakamoto,
+	})
+}
+
+// blocksEndpoint returns a page of blocks between from and to, inclusive
+func (m *Metrics) blocksEndpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	oldest, err := m.GetOldestBlock(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	newest, err := m.GetNewestBlock(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	from, err := uint32Param(r, "from", oldest)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	to, err := uint32Param(r, "to", newest)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	limit, err := pageSizeParam(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	// Fetch one extra block to find out if there is another page
+	blocks, err := m.store.GetBlocks(ctx, from, to, limit+1)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	response := blocksResponse{Blocks: []blockResponse{}}
+	if len(blocks) > limit {
+		nextFrom := blocks[limit].Height
+		response.NextFrom = &nextFrom
+		blocks = blocks[:limit]
+	}
+	for _, block := range blocks {
+		var timestamp *time.Time
+		if block.Timestamp.Valid {
+			timestamp = &block.Timestamp.Time
+		}
+		blockResp := blockResponse{
+			Height:           block.Height,
+			Timestamp:        timestamp,
+			TransactionBlock: block.TransactionBlock,
+			FarmerPuzzleHash: block.FarmerPuzzleHash,
+			FarmerAddress:    block.FarmerAddress,
+			HeaderHash:       block.HeaderHash,
+			PrevHeaderHash:   block.PrevHeaderHash,
+		}
+		if block.Weight != "" {
+			blockResp.Weight = block.Weight
+			blockResp.TotalIters = block.TotalIters
+			blockResp.SignagePointIndex = &block.SignagePointIndex
+			blockResp.PoolTargetPuzzleHash = block.PoolTargetPuzzleHash
+			blockResp.PoolAddress = block.PoolAddress
+			if block.PoolPublicKey.Valid {
+				blockResp.PoolPublicKey = &block.PoolPublicKey.String
+			}
+			if block.PoolContractPuzzleHash.Valid {
+				blockResp.PoolContractPuzzleHash = &block.PoolContractPuzzleHash.String
+			}
+			blockResp.PlotPublicKey = block.PlotPublicKey
+			blockResp.KSize = block.KSize
+		}
+		if block.Transactions != nil {
+			blockResp.Transactions = &blockTransactionsResponse{
+				Fees:               block.Transactions.Fees,
+				Cost:               block.Transactions.Cost,
+				RewardClaims:       block.Transactions.RewardClaims,
+				RewardClaimsAmount: block.Transactions.RewardClaimsAmount,
+			}
+			if block.Transactions.CoinsCounted {
+				blockResp.Transactions.Additions = &block.Transactions.Additions
+				blockResp.Transactions.Removals = &block.Transactions.Removals
+			}
+		}
+		response.Blocks = append(response.Blocks, blockResp)
+	}
+
+	writeJSON(w, response)
+}
+
+// topFarmersEndpoint returns the farmers that won the most blocks in the window, with their share of the window
+func (m *Metrics) topFarmersEndpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	height, window, adjusted, err := m.windowParams(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	n, err := intParam(r, "n", 10)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if n <= 0 || n > maxPageSize {
+		writeAPIError(w, badRequest(fmt.Errorf("n must be between 1 and %d", maxPageSize)))
+		return
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if offset < 0 {
+		writeAPIError(w, badRequest(fmt.Errorf("offset must not be negative")))
+		return
+	}
+
+	distribution, err := m.GetFarmerDistribution(ctx, height, window, m.ignoreAddressesFor(adjusted))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	response := topFarmersResponse{
+		Height:   height,
+		Window:   window,
+		Adjusted: adjusted,
+		Farmers:  []farmerResponse{},
+	}
+	for _, rank := range m.labelRanks(rankFarmers(distribution, window, offset, n)) {
+		response.Farmers = append(response.Farmers, farmerResponse{
+			Rank:          rank.Rank,
+			FarmerAddress: rank.FarmerAddress,
+			Blocks:        rank.Blocks,
+			Percent:       rank.Percent,
+			Label:         rank.Label,
+			Category:      rank.Category,
+			Notes:         rank.Notes,
+		})
+	}
+	if offset+n < len(distribution) {
+		nextOffset := offset + n
+		response.NextOffset = &nextOffset
+	}
+
+	writeJSON(w, response)
+}
+
+// statusEndpoint returns the range of blocks in the DB and the height the live metrics were last calculated at
+func (m *Metrics) statusEndpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	oldest, err := m.GetOldestBlock(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	newest, err := m.GetNewestBlock(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	m.peakLock.Lock()
+	peak := m.highestPeak
+	m.peakLock.Unlock()
+
+	writeJSON(w, statusResponse{
+		Network:        m.network.Name,
+		OldestBlock:    oldest,
+		NewestBlock:    newest,
+		PeakHeight:     peak,
+		LookbackWindow: m.LookbackWindow(),
+	})
+}
+
+// windowParams parses the params shared by the endpoints that look at a lookback window
+// The window is either a number of blocks, a duration before the peak block, or the blocks with timestamps after since
+// The peak is either a height, or the last block at or before until
+func (m *Metrics) windowParams(r *http.Request) (uint32, uint32, bool, error) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	var (
+		height uint32
+		err    error
+	)
+	switch {
+	case query.Get("height") != "" && query.Get("until") != "":
+		return 0, 0, false, badRequest(fmt.Errorf("only one of height and until can be set"))
+	case query.Get("height") != "":
+		height, err = uint32Param(r, "height", 0)
+	case query.Get("until") != "":
+		var until time.Time
+		until, err = timeParam(r, "until")
+		if err == nil {
+			height, err = m.GetHeightAtTime(ctx, until)
+		}
+	default:
+		height, err = m.GetNewestBlock(ctx)
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var window uint32
+	windowParamCount := 0
+	for _, name := range []string{"window", "duration", "since"} {
+		if query.Get(name) != "" {
+			windowParamCount++
+		}
+	}
+	switch {
+	case windowParamCount > 1:
+		return 0, 0, false, badRequest(fmt.Errorf("only one of window, duration, and since can be set"))
+	case query.Get("duration") != "":
+		duration, parseErr := ParseLookbackDuration(query.Get("duration"))
+		if parseErr != nil {
+			return 0, 0, false, badRequest(parseErr)
+		}
+		var peakTime time.Time
+		peakTime, err = m.GetBlockTimestamp(ctx, height)
+		if err == nil {
+			window, err = m.LookbackWindowSince(ctx, height, peakTime.Add(-duration.Duration))
+		}
+	case query.Get("since") != "":
+		var since time.Time
+		since, err = timeParam(r, "since")
+		if err == nil {
+			window, err = m.LookbackWindowSince(ctx, height, since)
+		}
+	default:
+		window, err = uint32Param(r, "window", m.LookbackWindow())
+		if err == nil && window == 0 {
+			err = badRequest(fmt.Errorf("window must be greater than 0"))
+		}
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	// Windows resolved from a duration or timestamp are capped too, so a since far in the past can't aggregate the
+	// whole chain
+	if maxWindow := m.config().apiMaxWindow; window > maxWindow {
+		return 0, 0, false, badRequest(fmt.Errorf("window of %d blocks is larger than the maximum of %d", window, maxWindow))
+	}
+
+	adjusted, err := boolParam(r, "adjusted", false)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return height, window, adjusted, nil
+}
+
+// ignoreAddressesFor returns the addresses to ignore for the adjusted or unadjusted figures
+func (m *Metrics) ignoreAddressesFor(adjusted bool) []string {
+	if !adjusted {
+		return []string{}
+	}
+	return m.AdjustedIgnoreAddresses()
+}
+
+// badRequestError is returned for invalid request parameters
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return badRequestError{err: err}
+}
+
+func uint32Param(r *http.Request, name string, defaultValue uint32) (uint32, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid %s: %s", name, value))
+	}
+	return uint32(parsed), nil
+}
+
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid %s: %s", name, value))
+	}
+	return parsed, nil
+}
+
+func boolParam(r *http.Request, name string, defaultValue bool) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, badRequest(fmt.Errorf("invalid %s: %s", name, value))
+	}
+	return parsed, nil
+}
+
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, badRequest(fmt.Errorf("invalid %s: %s. Must be an RFC 3339 timestamp", name, value))
+	}
+	return parsed, nil
+}
+
+func pageSizeParam(r *http.Request) (int, error) {
+	limit, err := intParam(r, "limit", defaultPageSize)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > maxPageSize {
+		return 0, badRequest(fmt.Errorf("limit must be between 1 and %d", maxPageSize))
+	}
+	return limit, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Errorf("Error writing API response: %s\n", err.Error())
+	}
+}
+
+// writeAPIError writes the error as JSON with a status code that matches the type of error. Internal errors are logged,
+// and the response only says there was an internal error
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := err.Error()
+	var (
+		badRequestErr     badRequestError
+		notEnoughBlockErr notEnoughBlocksError
+	)
+	if errors.As(err, &badRequestErr) {
+		status = http.StatusBadRequest
+	} else if errors.As(err, &notEnoughBlockErr) || errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusNotFound
+	} else {
+		// Internal errors can have details of the database in them, so they are only logged
+		log.Errorf("Error handling API request: %s\n", err.Error())
+		message = "internal error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodeErr := json.NewEncoder(w).Encode(apiError{Error: message})
+	if encodeErr != nil {
+		log.Errorf("Error writing API error response: %s\n", encodeErr.Error())
+	}
+}
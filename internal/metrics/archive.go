@@ -0,0 +1,467 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chia-network/block-metrics/internal/parquet"
+)
+
+const (
+	// ArchiveFormat identifies a block archive in the header line
+	ArchiveFormat = "block-metrics-blocks"
+
+	// ArchiveNDJSON and ArchiveParquet are the formats blocks can be exported in
+	ArchiveNDJSON  = "ndjson"
+	ArchiveParquet = "parquet"
+
+	// ArchiveSchemaVersion is the version of the block archive layout this binary writes
+	// Increment it when the fields of archiveBlock change, so older binaries refuse archives they can't read
+	ArchiveSchemaVersion = 1
+
+	// archivePageSize is how many blocks are read from or saved to the DB at a time
+	archivePageSize = 1000
+
+	// archiveLogInterval is how many blocks are exported or imported between progress logs. A multiple of the page size
+	archiveLogInterval = 100 * archivePageSize
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ArchiveHeader is the first line of a block archive
+type ArchiveHeader struct {
+	Format        string    `json:"format"`
+	SchemaVersion int       `json:"schema_version"`
+	Network       string    `json:"network"`
+	FromHeight    uint32    `json:"from_height"`
+	ToHeight      uint32    `json:"to_height"`
+	ExportedAt    time.Time `json:"exported_at"`
+}
+
+// archiveBlock is a line of a block archive, with the same fields as the blocks table
+// Fields that are null in the table, such as the transactions info of non transaction blocks, are null in the archive
+type archiveBlock struct {
+	Height                 uint32     `json:"height"`
+	Timestamp              *time.Time `json:"timestamp"`
+	TransactionBlock       bool       `json:"transaction_block"`
+	FarmerPuzzleHash       string     `json:"farmer_puzzle_hash"`
+	FarmerAddress          string     `json:"farmer_address"`
+	HeaderHash             string     `json:"header_hash"`
+	PrevHeaderHash         string     `json:"prev_header_hash"`
+	Weight                 string     `json:"weight"`
+	TotalIters             string     `json:"total_iters"`
+	SignagePointIndex      uint8      `json:"signage_point_index"`
+	PoolTargetPuzzleHash   string     `json:"pool_target_puzzle_hash"`
+	PoolAddress            string     `json:"pool_address"`
+	PoolPublicKey          *string    `json:"pool_public_key"`
+	PoolContractPuzzleHash *string    `json:"pool_contract_puzzle_hash"`
+	PlotPublicKey          string     `json:"plot_public_key"`
+	KSize                  uint8      `json:"k_size"`
+	Fees                   *uint64    `json:"fees"`
+	Cost                   *uint64    `json:"cost"`
+	Additions              *uint32    `json:"additions"`
+	Removals               *uint32    `json:"removals"`
+	RewardClaims           *uint32    `json:"reward_claims"`
+	RewardClaimsAmount     *uint64    `json:"reward_claims_amount"`
+}
+
+// newArchiveBlock converts the stored block to its archive line
+func newArchiveBlock(block BlockRecord) archiveBlock {
+	archived := archiveBlock{
+		Height:               block.Height,
+		TransactionBlock:     block.TransactionBlock,
+		FarmerPuzzleHash:     block.FarmerPuzzleHash,
+		FarmerAddress:        block.FarmerAddress,
+		HeaderHash:           block.HeaderHash,
+		PrevHeaderHash:       block.PrevHeaderHash,
+		Weight:               block.Weight,
+		TotalIters:           block.TotalIters,
+		SignagePointIndex:    block.SignagePointIndex,
+		PoolTargetPuzzleHash: block.PoolTargetPuzzleHash,
+		PoolAddress:          block.PoolAddress,
+		PlotPublicKey:        block.PlotPublicKey,
+		KSize:                block.KSize,
+	}
+	if block.Timestamp.Valid {
+		timestamp := block.Timestamp.Time.UTC()
+		archived.Timestamp = &timestamp
+	}
+	if block.PoolPublicKey.Valid {
+		archived.PoolPublicKey = &block.PoolPublicKey.String
+	}
+	if block.PoolContractPuzzleHash.Valid {
+		archived.PoolContractPuzzleHash = &block.PoolContractPuzzleHash.String
+	}
+	if tx := block.Transactions; tx != nil {
+		archived.Fees = &tx.Fees
+		archived.Cost = &tx.Cost
+		if tx.CoinsCounted {
+			archived.Additions = &tx.Additions
+			archived.Removals = &tx.Removals
+		}
+		archived.RewardClaims = &tx.RewardClaims
+		archived.RewardClaimsAmount = &tx.RewardClaimsAmount
+	}
+
+	return archived
+}
+
+// blockRecord converts the archive line back to the block to store
+func (a archiveBlock) blockRecord() BlockRecord {
+	block := BlockRecord{
+		Height:               a.Height,
+		TransactionBlock:     a.TransactionBlock,
+		FarmerPuzzleHash:     a.FarmerPuzzleHash,
+		FarmerAddress:        a.FarmerAddress,
+		HeaderHash:           a.HeaderHash,
+		PrevHeaderHash:       a.PrevHeaderHash,
+		Weight:               a.Weight,
+		TotalIters:           a.TotalIters,
+		SignagePointIndex:    a.SignagePointIndex,
+		PoolTargetPuzzleHash: a.PoolTargetPuzzleHash,
+		PoolAddress:          a.PoolAddress,
+		PlotPublicKey:        a.PlotPublicKey,
+		KSize:                a.KSize,
+	}
+	if a.Timestamp != nil {
+		block.Timestamp = sql.NullTime{Time: *a.Timestamp, Valid: true}
+	}
+	if a.PoolPublicKey != nil {
+		block.PoolPublicKey = sql.NullString{String: *a.PoolPublicKey, Valid: true}
+	}
+	if a.PoolContractPuzzleHash != nil {
+		block.PoolContractPuzzleHash = sql.NullString{String: *a.PoolContractPuzzleHash, Valid: true}
+	}
+	if a.Fees != nil {
+		block.Transactions = &BlockTransactions{
+			Fees:               *a.Fees,
+			Cost:               valueOrZero(a.Cost),
+			Additions:          valueOrZero(a.Additions),
+			Removals:           valueOrZero(a.Removals),
+			CoinsCounted:       a.Additions != nil && a.Removals != nil,
+			RewardClaims:       valueOrZero(a.RewardClaims),
+			RewardClaimsAmount: valueOrZero(a.RewardClaimsAmount),
+		}
+	}
+
+	return block
+}
+
+// valueOrZero returns the value the pointer points to, or the zero value if it's nil
+func valueOrZero[T any](value *T) T {
+	if value == nil {
+		var zero T
+		return zero
+	}
+	return *value
+}
+
+// ExportBlocks writes the blocks from fromHeight up to and including toHeight to a block archive at the path, and returns
+// the number of blocks written. A toHeight of 0 exports up to the newest block
+// The format is ArchiveNDJSON or ArchiveParquet, or empty to pick parquet for paths ending in .parquet and NDJSON
+// otherwise. NDJSON archives have the ArchiveHeader on the first line and a block on each line after, lowest height
+// first, and paths ending in .zst are zstd compressed and paths ending in .gz are gzip compressed. Parquet archives have
+// a column for each block field, with the ArchiveHeader fields in the file metadata
+func (m *Metrics) ExportBlocks(ctx context.Context, path string, format string, fromHeight uint32, toHeight uint32) (int, error) {
+	if format == "" {
+		format = ArchiveNDJSON
+		if strings.HasSuffix(path, ".parquet") {
+			format = ArchiveParquet
+		}
+	}
+	if format != ArchiveNDJSON && format != ArchiveParquet {
+		return 0, fmt.Errorf("unsupported archive format %s. Must be %s or %s", format, ArchiveNDJSON, ArchiveParquet)
+	}
+	if format == ArchiveParquet && (strings.HasSuffix(path, ".zst") || strings.HasSuffix(path, ".gz")) {
+		return 0, fmt.Errorf("parquet archives are compressed internally, so the path can't end in .zst or .gz")
+	}
+
+	if toHeight == 0 {
+		newest, err := m.GetNewestBlock(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("error getting the newest block: %w", err)
+		}
+		toHeight = newest
+	}
+	if fromHeight > toHeight {
+		return 0, fmt.Errorf("from height %d is above to height %d", fromHeight, toHeight)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	if format == ArchiveParquet {
+		count, err := m.writeParquetArchive(ctx, file, fromHeight, toHeight)
+		return count, errors.Join(err, file.Close())
+	}
+
+	output, err := compressedWriter(file, path)
+	if err != nil {
+		return 0, errors.Join(err, file.Close())
+	}
+
+	count, err := m.writeArchive(ctx, output, fromHeight, toHeight)
+	// The compressed writer must be closed first, to flush the end of the stream to the file
+	return count, errors.Join(err, output.Close(), file.Close())
+}
+
+// newArchiveHeader returns the header for an archive of the blocks from fromHeight up to and including toHeight
+func (m *Metrics) newArchiveHeader(fromHeight uint32, toHeight uint32) ArchiveHeader {
+	return ArchiveHeader{
+		Format:        ArchiveFormat,
+		SchemaVersion: ArchiveSchemaVersion,
+		Network:       m.network.Name,
+		FromHeight:    fromHeight,
+		ToHeight:      toHeight,
+		ExportedAt:    time.Now().UTC(),
+	}
+}
+
+// writeArchive writes the header and the blocks from fromHeight up to and including toHeight to the writer as NDJSON
+func (m *Metrics) writeArchive(ctx context.Context, w io.Writer, fromHeight uint32, toHeight uint32) (int, error) {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	err := encoder.Encode(m.newArchiveHeader(fromHeight, toHeight))
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := m.exportBlocks(ctx, fromHeight, toHeight, func(block archiveBlock) error {
+		return encoder.Encode(block)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, buffered.Flush()
+}
+
+// exportBlocks reads the blocks from fromHeight up to and including toHeight from the DB in pages, and calls write with
+// each of them, lowest height first
+func (m *Metrics) exportBlocks(ctx context.Context, fromHeight uint32, toHeight uint32, write func(archiveBlock) error) (int, error) {
+	var count int
+	next := fromHeight
+	for {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+
+		blocks, err := m.store.GetBlocks(ctx, next, toHeight, archivePageSize)
+		if err != nil {
+			return count, fmt.Errorf("error reading blocks from %d: %w", next, err)
+		}
+		for _, block := range blocks {
+			err = write(newArchiveBlock(block))
+			if err != nil {
+				return count, err
+			}
+		}
+		count += len(blocks)
+
+		if len(blocks) < archivePageSize {
+			break
+		}
+		last := blocks[len(blocks)-1].Height
+		if last >= toHeight {
+			break
+		}
+		next = last + 1
+		if count%archiveLogInterval == 0 {
+			log.Printf("Exported %d blocks, up to height %d\n", count, last)
+		}
+	}
+
+	return count, nil
+}
+
+// ImportBlocks saves the blocks from fromHeight up to and including toHeight in the block archive at the path, and
+// returns the number of blocks saved. A toHeight of 0 imports up to the last block in the archive
+// Blocks that are already stored are updated. The archive must be from this network, and a schema version this binary
+// supports. Parquet archives and compressed NDJSON archives are detected from their contents
+func (m *Metrics) ImportBlocks(ctx context.Context, path string, fromHeight uint32, toHeight uint32) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Errorf("Error closing archive %s: %s\n", path, err.Error())
+		}
+	}()
+
+	magic := make([]byte, 4)
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	if parquet.Magic(magic[:n]) {
+		info, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return m.readParquetArchive(ctx, file, info.Size(), fromHeight, toHeight)
+	}
+
+	input, err := decompressedReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := input.Close()
+		if err != nil {
+			log.Errorf("Error closing archive %s: %s\n", path, err.Error())
+		}
+	}()
+
+	return m.readArchive(ctx, input, fromHeight, toHeight)
+}
+
+// readArchive checks the header, and saves the blocks in the height range from the NDJSON reader
+func (m *Metrics) readArchive(ctx context.Context, r io.Reader, fromHeight uint32, toHeight uint32) (int, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+
+	var header ArchiveHeader
+	err := decoder.Decode(&header)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the archive header: %w", err)
+	}
+	err = m.checkArchiveHeader(header)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.importBlocks(ctx, fromHeight, toHeight, func() (archiveBlock, error) {
+		var archived archiveBlock
+		err := decoder.Decode(&archived)
+		return archived, err
+	})
+}
+
+// checkArchiveHeader returns an error if the archive isn't a block archive this binary can import into this network
+func (m *Metrics) checkArchiveHeader(header ArchiveHeader) error {
+	if header.Format != ArchiveFormat {
+		return fmt.Errorf("not a block archive. The header format is %q", header.Format)
+	}
+	if header.SchemaVersion < 1 || header.SchemaVersion > ArchiveSchemaVersion {
+		return fmt.Errorf("archive schema version %d is not supported. This binary supports up to version %d", header.SchemaVersion, ArchiveSchemaVersion)
+	}
+	if header.Network != m.network.Name {
+		return fmt.Errorf("archive is from network %s, but this database is tracking %s", header.Network, m.network.Name)
+	}
+	log.Printf("Importing %s blocks %d to %d, exported at %s\n", header.Network, header.FromHeight, header.ToHeight, header.ExportedAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// importBlocks saves the blocks in the height range returned by next in pages, until next returns io.EOF
+func (m *Metrics) importBlocks(ctx context.Context, fromHeight uint32, toHeight uint32, next func() (archiveBlock, error)) (int, error) {
+	var (
+		count int
+		page  []BlockRecord
+	)
+	savePage := func() error {
+		if len(page) == 0 {
+			return nil
+		}
+		err := m.store.SaveBlocks(ctx, page)
+		if err != nil {
+			return fmt.Errorf("error saving blocks %d to %d: %w", page[0].Height, page[len(page)-1].Height, err)
+		}
+		count += len(page)
+		if count%archiveLogInterval == 0 {
+			log.Printf("Imported %d blocks, up to height %d\n", count, page[len(page)-1].Height)
+		}
+		page = page[:0]
+		return nil
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+
+		archived, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("error reading the block after %d blocks: %w", count+len(page), err)
+		}
+		if archived.Height < fromHeight || (toHeight != 0 && archived.Height > toHeight) {
+			continue
+		}
+
+		page = append(page, archived.blockRecord())
+		if len(page) == archivePageSize {
+			err = savePage()
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, savePage()
+}
+
+// compressedWriter wraps the writer with the compression for the path's extension
+func compressedWriter(w io.Writer, path string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".zst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(path, ".gz"):
+		return gzip.NewWriter(w), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// decompressedReader wraps the reader with the decompression for the compression the stream starts with, if any
+func decompressedReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
+
+// nopWriteCloser is a WriteCloser for writers that don't need to be closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
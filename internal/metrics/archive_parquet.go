@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/chia-network/block-metrics/internal/parquet"
+)
+
+// archiveColumns are the columns of a parquet archive, in the order and with the names of the archiveBlock fields
+var archiveColumns = []parquet.Column{
+	{Name: "height", Kind: parquet.Uint32},
+	{Name: "timestamp", Kind: parquet.Timestamp, Optional: true},
+	{Name: "transaction_block", Kind: parquet.Boolean},
+	{Name: "farmer_puzzle_hash", Kind: parquet.String},
+	{Name: "farmer_address", Kind: parquet.String},
+	{Name: "header_hash", Kind: parquet.String},
+	{Name: "prev_header_hash", Kind: parquet.String},
+	{Name: "weight", Kind: parquet.String},
+	{Name: "total_iters", Kind: parquet.String},
+	{Name: "signage_point_index", Kind: parquet.Uint8},
+	{Name: "pool_target_puzzle_hash", Kind: parquet.String},
+	{Name: "pool_address", Kind: parquet.String},
+	{Name: "pool_public_key", Kind: parquet.String, Optional: true},
+	{Name: "pool_contract_puzzle_hash", Kind: parquet.String, Optional: true},
+	{Name: "plot_public_key", Kind: parquet.String},
+	{Name: "k_size", Kind: parquet.Uint8},
+	{Name: "fees", Kind: parquet.Uint64, Optional: true},
+	{Name: "cost", Kind: parquet.Uint64, Optional: true},
+	{Name: "additions", Kind: parquet.Uint32, Optional: true},
+	{Name: "removals", Kind: parquet.Uint32, Optional: true},
+	{Name: "reward_claims", Kind: parquet.Uint32, Optional: true},
+	{Name: "reward_claims_amount", Kind: parquet.Uint64, Optional: true},
+}
+
+// The file metadata keys of the ArchiveHeader fields in a parquet archive
+const (
+	archiveKeyFormat        = "format"
+	archiveKeySchemaVersion = "schema_version"
+	archiveKeyNetwork       = "network"
+	archiveKeyFromHeight    = "from_height"
+	archiveKeyToHeight      = "to_height"
+	archiveKeyExportedAt    = "exported_at"
+)
+
+// writeParquetArchive writes the blocks from fromHeight up to and including toHeight to the writer as parquet, with the
+// header in the file metadata
+func (m *Metrics) writeParquetArchive(ctx context.Context, w io.Writer, fromHeight uint32, toHeight uint32) (int, error) {
+	header := m.newArchiveHeader(fromHeight, toHeight)
+	writer, err := parquet.NewWriter(w, archiveColumns, map[string]string{
+		archiveKeyFormat:        header.Format,
+		archiveKeySchemaVersion: strconv.Itoa(header.SchemaVersion),
+		archiveKeyNetwork:       header.Network,
+		archiveKeyFromHeight:    strconv.FormatUint(uint64(header.FromHeight), 10),
+		archiveKeyToHeight:      strconv.FormatUint(uint64(header.ToHeight), 10),
+		archiveKeyExportedAt:    header.ExportedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := m.exportBlocks(ctx, fromHeight, toHeight, func(block archiveBlock) error {
+		return writer.Write(block.parquetRow())
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, writer.Close()
+}
+
+// readParquetArchive checks the header in the file metadata, and saves the blocks in the height range from the parquet
+// file, which is size bytes long
+func (m *Metrics) readParquetArchive(ctx context.Context, r io.ReaderAt, size int64, fromHeight uint32, toHeight uint32) (int, error) {
+	reader, err := parquet.NewReader(r, size)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the parquet archive: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	header, err := parquetArchiveHeader(reader.Metadata())
+	if err != nil {
+		return 0, err
+	}
+	err = m.checkArchiveHeader(header)
+	if err != nil {
+		return 0, err
+	}
+
+	indexes, err := parquetArchiveIndexes(reader.Columns())
+	if err != nil {
+		return 0, err
+	}
+
+	return m.importBlocks(ctx, fromHeight, toHeight, func() (archiveBlock, error) {
+		row, err := reader.Read()
+		if err != nil {
+			return archiveBlock{}, err
+		}
+		values := make([]any, len(indexes))
+		for i, index := range indexes {
+			values[i] = row[index]
+		}
+		return archiveBlockFromParquet(values), nil
+	})
+}
+
+// parquetArchiveHeader returns the header from the file metadata of a parquet archive
+func parquetArchiveHeader(metadata map[string]string) (ArchiveHeader, error) {
+	header := ArchiveHeader{
+		Format:  metadata[archiveKeyFormat],
+		Network: metadata[archiveKeyNetwork],
+	}
+	if header.Format != ArchiveFormat {
+		return ArchiveHeader{}, fmt.Errorf("not a block archive. The metadata format is %q", header.Format)
+	}
+
+	var err error
+	header.SchemaVersion, err = strconv.Atoi(metadata[archiveKeySchemaVersion])
+	if err != nil {
+		return ArchiveHeader{}, fmt.Errorf("invalid archive schema version: %w", err)
+	}
+	fromHeight, err := strconv.ParseUint(metadata[archiveKeyFromHeight], 10, 32)
+	if err != nil {
+		return ArchiveHeader{}, fmt.Errorf("invalid archive from height: %w", err)
+	}
+	toHeight, err := strconv.ParseUint(metadata[archiveKeyToHeight], 10, 32)
+	if err != nil {
+		return ArchiveHeader{}, fmt.Errorf("invalid archive to height: %w", err)
+	}
+	header.FromHeight = uint32(fromHeight)
+	header.ToHeight = uint32(toHeight)
+	header.ExportedAt, err = time.Parse(time.RFC3339, metadata[archiveKeyExportedAt])
+	if err != nil {
+		return ArchiveHeader{}, fmt.Errorf("invalid archive export time: %w", err)
+	}
+
+	return header, nil
+}
+
+// parquetArchiveIndexes returns the index in the file of each of the archiveColumns, checking they have the same kind
+// Required columns must be required in the file too, so their values are never nil
+func parquetArchiveIndexes(columns []parquet.Column) ([]int, error) {
+	byName := map[string]int{}
+	for i, column := range columns {
+		byName[column.Name] = i
+	}
+
+	indexes := make([]int, len(archiveColumns))
+	for i, want := range archiveColumns {
+		index, ok := byName[want.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive is missing the %s column", want.Name)
+		}
+		got := columns[index]
+		if got.Kind != want.Kind || (got.Optional && !want.Optional) {
+			return nil, fmt.Errorf("archive column %s is %s, but must be %s", want.Name, describeParquetColumn(got), describeParquetColumn(want))
+		}
+		indexes[i] = index
+	}
+	return indexes, nil
+}
+
+// describeParquetColumn returns the kind of the column, and whether it's optional
+func describeParquetColumn(column parquet.Column) string {
+	if column.Optional {
+		return "optional " + column.Kind.String()
+	}
+	return column.Kind.String()
+}
+
+// parquetRow returns the values of the archiveColumns for the block
+func (a archiveBlock) parquetRow() []any {
+	return []any{
+		a.Height,
+		parquetOptional(a.Timestamp),
+		a.TransactionBlock,
+		a.FarmerPuzzleHash,
+		a.FarmerAddress,
+		a.HeaderHash,
+		a.PrevHeaderHash,
+		a.Weight,
+		a.TotalIters,
+		a.SignagePointIndex,
+		a.PoolTargetPuzzleHash,
+		a.PoolAddress,
+		parquetOptional(a.PoolPublicKey),
+		parquetOptional(a.PoolContractPuzzleHash),
+		a.PlotPublicKey,
+		a.KSize,
+		parquetOptional(a.Fees),
+		parquetOptional(a.Cost),
+		parquetOptional(a.Additions),
+		parquetOptional(a.Removals),
+		parquetOptional(a.RewardClaims),
+		parquetOptional(a.RewardClaimsAmount),
+	}
+}
+
+// archiveBlockFromParquet returns the block for the values of the archiveColumns
+func archiveBlockFromParquet(values []any) archiveBlock {
+	return archiveBlock{
+		Height:                 values[0].(uint32),
+		Timestamp:              parquetPointer[time.Time](values[1]),
+		TransactionBlock:       values[2].(bool),
+		FarmerPuzzleHash:       values[3].(string),
+		FarmerAddress:          values[4].(string),
+		HeaderHash:             values[5].(string),
+		PrevHeaderHash:         values[6].(string),
+		Weight:                 values[7].(string),
+		TotalIters:             values[8].(string),
+		SignagePointIndex:      values[9].(uint8),
+		PoolTargetPuzzleHash:   values[10].(string),
+		PoolAddress:            values[11].(string),
+		PoolPublicKey:          parquetPointer[string](values[12]),
+		PoolContractPuzzleHash: parquetPointer[string](values[13]),
+		PlotPublicKey:          values[14].(string),
+		KSize:                  values[15].(uint8),
+		Fees:                   parquetPointer[uint64](values[16]),
+		Cost:                   parquetPointer[uint64](values[17]),
+		Additions:              parquetPointer[uint32](values[18]),
+		Removals:               parquetPointer[uint32](values[19]),
+		RewardClaims:           parquetPointer[uint32](values[20]),
+		RewardClaimsAmount:     parquetPointer[uint64](values[21]),
+	}
+}
+
+// parquetOptional returns the value the pointer points to, or nil for a null value
+func parquetOptional[T any](value *T) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// parquetPointer returns a pointer to the value of an optional column, or nil if it's null
+func parquetPointer[T any](value any) *T {
+	if value == nil {
+		return nil
+	}
+	typed := value.(T)
+	return &typed
+}
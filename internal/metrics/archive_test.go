@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// archiveFixtureBlocks is the number of blocks in the archive fixture, enough for several pages
+const archiveFixtureBlocks = 2500
+
+// archiveFixtureBlock returns a block with every field set, varying which of the optional fields are null
+func archiveFixtureBlock(height uint32) BlockRecord {
+	block := BlockRecord{
+		Height:               height,
+		Timestamp:            sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(height) * 18 * time.Second), Valid: true},
+		FarmerPuzzleHash:     fmt.Sprintf("0x%064x", height%7),
+		FarmerAddress:        fmt.Sprintf("xch1farmer%d", height%7),
+		HeaderHash:           fmt.Sprintf("0x%064x", height),
+		PrevHeaderHash:       fmt.Sprintf("0x%064x", height-1),
+		Weight:               fmt.Sprintf("%d00000000000000000000", height),
+		TotalIters:           fmt.Sprintf("%d000000000000", height),
+		SignagePointIndex:    uint8(height % 64),
+		PoolTargetPuzzleHash: fmt.Sprintf("0x%064x", height%3),
+		PoolAddress:          fmt.Sprintf("xch1pool%d", height%3),
+		PlotPublicKey:        fmt.Sprintf("0x%096x", height),
+		KSize:                32,
+	}
+	if height%2 == 0 {
+		block.PoolContractPuzzleHash = sql.NullString{String: fmt.Sprintf("0x%064x", height%5), Valid: true}
+	} else {
+		block.PoolPublicKey = sql.NullString{String: fmt.Sprintf("0x%096x", height%5), Valid: true}
+	}
+	if height%3 == 0 {
+		block.TransactionBlock = true
+		block.Transactions = &BlockTransactions{
+			Fees:               uint64(height) * 1_000_000,
+			Cost:               uint64(height) * 1_000,
+			RewardClaims:       2,
+			RewardClaimsAmount: 250_000_000_000,
+		}
+		// Only some of the blocks have their coins counted
+		if height%9 == 0 {
+			block.Transactions.Additions = height % 50
+			block.Transactions.Removals = height % 40
+			block.Transactions.CoinsCounted = true
+		}
+	}
+	return block
+}
+
+// TestExportImportBlocks checks every field of the blocks exported in each format is imported again
+func TestExportImportBlocks(t *testing.T) {
+	ctx := context.Background()
+
+	source := &Metrics{network: Network{Name: "mainnet"}, store: newTestStore(t)}
+	var blocks []BlockRecord
+	for height := uint32(1); height <= archiveFixtureBlocks; height++ {
+		blocks = append(blocks, archiveFixtureBlock(height))
+	}
+	err := source.store.SaveBlocks(ctx, blocks)
+	if err != nil {
+		t.Fatalf("error saving blocks: %s", err.Error())
+	}
+	stored, err := source.store.GetBlocks(ctx, 0, archiveFixtureBlocks, archiveFixtureBlocks)
+	if err != nil {
+		t.Fatalf("error reading the stored blocks: %s", err.Error())
+	}
+
+	tests := []struct {
+		file   string
+		format string
+	}{
+		{file: "blocks.ndjson"},
+		{file: "blocks.ndjson.gz"},
+		{file: "blocks.ndjson.zst"},
+		{file: "blocks.parquet"},
+		{file: "blocks.data", format: ArchiveParquet},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			count, err := source.ExportBlocks(ctx, path, test.format, 0, 0)
+			if err != nil {
+				t.Fatalf("error exporting: %s", err.Error())
+			}
+			if count != archiveFixtureBlocks {
+				t.Fatalf("exported %d blocks, want %d", count, archiveFixtureBlocks)
+			}
+
+			target := &Metrics{network: Network{Name: "mainnet"}, store: newTestStore(t)}
+			count, err = target.ImportBlocks(ctx, path, 0, 0)
+			if err != nil {
+				t.Fatalf("error importing: %s", err.Error())
+			}
+			if count != archiveFixtureBlocks {
+				t.Fatalf("imported %d blocks, want %d", count, archiveFixtureBlocks)
+			}
+			imported, err := target.store.GetBlocks(ctx, 0, archiveFixtureBlocks, archiveFixtureBlocks)
+			if err != nil {
+				t.Fatalf("error reading the imported blocks: %s", err.Error())
+			}
+			if len(imported) != len(stored) {
+				t.Fatalf("imported %d blocks, want %d", len(imported), len(stored))
+			}
+			for i := range stored {
+				if !reflect.DeepEqual(imported[i], stored[i]) {
+					t.Fatalf("imported block %d is %+v, want %+v", stored[i].Height, imported[i], stored[i])
+				}
+			}
+
+			// Only the blocks in the height range are imported
+			ranged := &Metrics{network: Network{Name: "mainnet"}, store: newTestStore(t)}
+			count, err = ranged.ImportBlocks(ctx, path, 1000, 1999)
+			if err != nil {
+				t.Fatalf("error importing the range: %s", err.Error())
+			}
+			oldest, errOldest := ranged.store.GetOldestBlock(ctx)
+			newest, errNewest := ranged.store.GetNewestBlock(ctx)
+			if count != 1000 || errOldest != nil || errNewest != nil || oldest != 1000 || newest != 1999 {
+				t.Fatalf("imported %d blocks from %d to %d, want 1000 from 1000 to 1999", count, oldest, newest)
+			}
+
+			// Archives from another network are refused
+			testnet := &Metrics{network: Network{Name: "testnet11"}, store: newTestStore(t)}
+			_, err = testnet.ImportBlocks(ctx, path, 0, 0)
+			if err == nil {
+				t.Fatalf("expected an error importing a mainnet archive into testnet11")
+			}
+		})
+	}
+}
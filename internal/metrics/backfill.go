@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chia-network/go-chia-libs/pkg/rpc"
+	"github.com/chia-network/go-chia-libs/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// backfillPage is a page of blocks to fetch from the full node. Start is inclusive and End is exclusive, to match the
+// GetBlocks RPC
+type backfillPage struct {
+	Start uint32
+	End   uint32
+}
+
+type backfillResult struct {
+	records []BlockRecord
+	err     error
+}
+
+// BackfillBlocks loads all the blocks below the oldest block in the DB from the chia full node and stores the relevant
+// data into the metrics DB
+// Pages are fetched by concurrent workers and saved by a single writer, highest page first, so there is useful data ASAP.
+// Each saved page is recorded as a checkpoint, so a backfill that is stopped resumes where it left off
+func (m *Metrics) BackfillBlocks(ctx context.Context, workers int) error {
+	// We will start with either the oldest block in the DB, or the blockchain peak height, if the DB is empty
+	top, err := m.GetOldestBlock(ctx)
+	if err != nil && m.nodeDB != nil {
+		top, err = m.nodeDB.peakHeight(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting the peak from the full node database: %w", err)
+		}
+	} else if err != nil {
+		err = m.withNode(nil, func(node *fullNode) error {
+			state, _, err := node.rpcClient.FullNodeService.GetBlockchainState()
+			if err != nil {
+				return err
+			}
+			if state.BlockchainState.IsAbsent() || state.BlockchainState.MustGet().Peak.IsAbsent() {
+				return fmt.Errorf("blockchain state or peak not present in the response")
+			}
+			top = state.BlockchainState.MustGet().Peak.MustGet().Height
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error getting blockchain state: %w", err)
+		}
+	}
+
+	checkpoints, err := m.store.GetBackfillCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	pages := backfillPages(top, checkpoints, m.rpcPerPage)
+	if len(pages) == 0 {
+		log.Println("No blocks to backfill")
+		return nil
+	}
+
+	log.Printf("Backfilling blocks below height %d\n", top)
+	err = m.fetchAndSavePages(ctx, pages, workers, func(page backfillPage) error {
+		return m.store.SaveBackfillCheckpoint(ctx, BackfillCheckpoint{Start: page.Start, End: page.End - 1})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pages are saved highest first, so the non-TX blocks at the bottom of each page don't have the preceding TX block
+	// to borrow a timestamp from when they are saved. Fill them all in at the end
+	return m.FillTimestampGaps(ctx)
+}
+
+// fetchAndSavePages fetches the pages of blocks from the full node with concurrent workers, and saves them in the order
+// of pages with a single writer. saved, if not nil, is called after each page is saved
+func (m *Metrics) fetchAndSavePages(ctx context.Context, pages []backfillPage, workers int, saved func(page backfillPage) error) error {
+	if workers < 1 {
+		return fmt.Errorf("need at least 1 worker to fetch blocks")
+	}
+
+	var total uint32
+	for _, page := range pages {
+		total += page.End - page.Start
+	}
+	log.Printf("Fetching %d blocks with %d workers\n", total, workers)
+
+	ctx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	defer func() {
+		// Stop handing out pages before waiting for the workers, otherwise they would wait on the queue forever
+		cancel()
+		wg.Wait()
+	}()
+
+	// Each page gets its own result channel, so the writer can save them in order no matter which worker finishes first
+	// The semaphore limits how many pages are fetched ahead of the writer, so memory use stays bounded
+	results := make([]chan backfillResult, len(pages))
+	for i := range results {
+		results[i] = make(chan backfillResult, 1)
+	}
+	semaphore := make(chan struct{}, workers*2)
+	queue := make(chan int)
+
+	go func() {
+		defer close(queue)
+		for i := range pages {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				records, err := m.fetchBlockRecords(ctx, pages[i])
+				results[i] <- backfillResult{records: records, err: err}
+			}
+		}()
+	}
+
+	progress := newBackfillProgress(total)
+	for i, page := range pages {
+		var result backfillResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if result.err != nil {
+			return fmt.Errorf("error fetching blocks between %d and %d: %w", page.Start, page.End, result.err)
+		}
+
+		err := m.store.SaveBlocks(ctx, result.records)
+		if err != nil {
+			return err
+		}
+
+		if saved != nil {
+			err = saved(page)
+			if err != nil {
+				return err
+			}
+		}
+
+		<-semaphore
+		progress.add(page.End - page.Start)
+	}
+	progress.finish()
+
+	return nil
+}
+
+// fetchBlockRecords fetches the page of blocks from the full node and converts them to the records we store in the DB
+// This runs in the workers, so the additional RPC calls to count the coins, with count-coins, are concurrent too
+func (m *Metrics) fetchBlockRecords(ctx context.Context, page backfillPage) ([]BlockRecord, error) {
+	blocks, err := m.fetchBlocks(ctx, page.Start, page.End)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.newBlockRecords(ctx, blocks, m.countCoinsInBatches())
+}
+
+// fetchBlocks fetches the blocks from start up to, but not including, end from the full node, or the full node
+// database when one is open
+func (m *Metrics) fetchBlocks(ctx context.Context, start, end uint32) ([]types.FullBlock, error) {
+	if m.nodeDB != nil {
+		return m.nodeDB.blocks(ctx, start, end)
+	}
+
+	var blocks []types.FullBlock
+	err := m.withNode(nil, func(node *fullNode) error {
+		resp, _, err := node.rpcClient.FullNodeService.GetBlocks(&rpc.GetBlocksOptions{
+			Start:          int(start),
+			End:            int(end),
+			ExcludeReorged: true,
+		})
+		if err != nil {
+			return err
+		}
+		if resp.Blocks.IsAbsent() {
+			return fmt.Errorf("unable to fetch batch of blocks")
+		}
+		blocks = resp.Blocks.MustGet()
+		return nil
+	})
+
+	return blocks, err
+}
+
+// backfillPages splits the heights below top that are not covered by a checkpoint into pages of at most perPage
+// blocks, highest first
+func backfillPages(top uint32, checkpoints []BackfillCheckpoint, perPage uint32) []backfillPage {
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].End > checkpoints[j].End
+	})
+
+	// Walk down from the top, collecting the ranges between checkpoints
+	var pending []backfillPage
+	cursor := top
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Start >= cursor {
+			continue
+		}
+		if checkpoint.End+1 < cursor {
+			pending = append(pending, backfillPage{Start: checkpoint.End + 1, End: cursor})
+		}
+		cursor = checkpoint.Start
+	}
+	if cursor > 0 {
+		pending = append(pending, backfillPage{Start: 0, End: cursor})
+	}
+
+	var pages []backfillPage
+	for _, pendingRange := range pending {
+		pages = append(pages, splitPages(pendingRange.Start, pendingRange.End, perPage)...)
+	}
+
+	return pages
+}
+
+// splitPages splits the heights from start up to, but not including, end into pages of at most perPage blocks,
+// highest first
+func splitPages(start, end uint32, perPage uint32) []backfillPage {
+	var pages []backfillPage
+	for end > start {
+		pageStart := start
+		if end-start > perPage {
+			pageStart = end - perPage
+		}
+		pages = append(pages, backfillPage{Start: pageStart, End: end})
+		end = pageStart
+	}
+
+	return pages
+}
+
+// backfillProgress logs how far along the backfill is, the rate blocks are being saved, and the estimated time left
+type backfillProgress struct {
+	total     uint32
+	done      uint32
+	started   time.Time
+	lastPrint time.Time
+}
+
+func newBackfillProgress(total uint32) *backfillProgress {
+	now := time.Now()
+	return &backfillProgress{
+		total:     total,
+		started:   now,
+		lastPrint: now,
+	}
+}
+
+func (p *backfillProgress) add(blocks uint32) {
+	p.done += blocks
+	if time.Since(p.lastPrint) < 10*time.Second {
+		return
+	}
+	p.lastPrint = time.Now()
+
+	elapsed := time.Since(p.started)
+	rate := float64(p.done) / elapsed.Seconds()
+	eta := time.Duration(float64(p.total-p.done)/rate) * time.Second
+	log.Printf("Backfilled %d of %d blocks (%.1f%%) at %.0f blocks/sec. ETA %s\n",
+		p.done, p.total, float64(p.done)/float64(p.total)*100, rate, eta.Round(time.Second))
+}
+
+func (p *backfillProgress) finish() {
+	elapsed := time.Since(p.started)
+	log.Printf("Backfilled %d blocks in %s at %.0f blocks/sec\n", p.done, elapsed.Round(time.Second), float64(p.done)/elapsed.Seconds())
+}
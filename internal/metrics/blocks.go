@@ -1,162 +1,60 @@
 package metrics
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/chia-network/go-chia-libs/pkg/bech32m"
 	"github.com/chia-network/go-chia-libs/pkg/rpc"
 	"github.com/chia-network/go-chia-libs/pkg/types"
-	"github.com/schollz/progressbar/v3"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
-// BackfillBlocks loads all the blocks from the chia full node and stores the relevant data into the metrics DB
-func (m *Metrics) BackfillBlocks() error {
-	var (
-		oldestHeight uint32
-	)
-
-	// We will start with either the oldest block in the DB, or the blockchain peak height, if the DB is empty
-	oldestRow := m.mysqlClient.QueryRow("select height from blocks order by height asc limit 1")
-	err := oldestRow.Scan(&oldestHeight)
-	if err != nil {
-		state, _, err := m.websocketClient.FullNodeService.GetBlockchainState()
-		if err != nil {
-			log.Fatalf("Error getting blockchain state: %s\n", err.Error())
-		}
-		if state.BlockchainState.IsAbsent() || state.BlockchainState.MustGet().Peak.IsAbsent() {
-			return fmt.Errorf("blockchain state or peak not present in the response")
-		}
-
-		oldestHeight = state.BlockchainState.MustGet().Peak.MustGet().Height
-	}
-
-	start := oldestHeight - m.rpcPerPage
-	end := oldestHeight
-
-	bar := progressbar.Default(int64(oldestHeight))
-	for {
-		err = m.fetchAndSaveBlocksBetween(start, end)
-		if err != nil {
-			return err
-		}
-
-		err = bar.Add(int(m.rpcPerPage))
-		_ = err // Just the progress bar, so it's not critical
-
-		if start <= 0 {
-			err = bar.Finish()
-			_ = err // Just the progress bar, so it's not critical
-			break
-		}
-		if start <= m.rpcPerPage {
-			start = 0
-		} else {
-			start = start - m.rpcPerPage
-		}
-		end = end - m.rpcPerPage
-
-		// Fills any missing timestamps
-		err = m.FillTimestampGaps()
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (m *Metrics) fetchAndSaveBlocksBetween(start, end uint32) error {
-	blocks, _, err := m.websocketClient.FullNodeService.GetBlocks(&rpc.GetBlocksOptions{
-		Start:          int(start),
-		End:            int(end),
-		ExcludeReorged: true,
-	})
+// fetchAndSaveBlocksBetween fetches the blocks from start up to, but not including, end and saves them
+// The blocks are fetched the same way as the backfill, from the full node database when one is open
+func (m *Metrics) fetchAndSaveBlocksBetween(ctx context.Context, start, end uint32) error {
+	blocks, err := m.fetchBlocks(ctx, start, end)
 	if err != nil {
 		return err
 	}
 
 	// Write to DB
-	if blocks.Blocks.IsAbsent() {
-		return fmt.Errorf("unable to fetch batch of blocks")
-	}
-
-	for _, block := range blocks.Blocks.MustGet() {
-		err = m.saveBlock(block)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return m.saveBlocks(ctx, blocks, m.countCoinsInBatches())
 }
 
 // FillBlockGaps looks for gaps in the blocks table and fetches the missing blocks
 // Avoids anything below the lowest block currently in the table
 // We work from lowest height to the highest height, so that we can always be sure the preceding transaction block
 // is present before the non-tx blocks that follow it, so that we can borrow the timestamp from the TX block
-func (m *Metrics) FillBlockGaps() error {
+func (m *Metrics) FillBlockGaps(ctx context.Context) error {
 	m.fillGapsLock.Lock()
 	defer m.fillGapsLock.Unlock()
-	query := "SELECT (t1.height + 1) as gap_starts_at, " +
-		"       (SELECT MIN(t3.height) -1 FROM blocks t3 WHERE t3.height > t1.height) as gap_ends_at " +
-		"FROM blocks t1 " +
-		"WHERE NOT EXISTS (SELECT t2.height FROM blocks t2 WHERE t2.height = t1.height + 1) " +
-		"HAVING gap_ends_at IS NOT NULL"
 
-	rows, err := m.mysqlClient.Query(query)
+	// Gaps are sorted lowest to highest, so we can properly fill timestamps
+	gaps, err := m.store.GetBlockGaps(ctx)
 	if err != nil {
 		return err
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Errorf("Could not close rows: %s\n", err.Error())
-		}
-	}(rows)
-
-	var (
-		start uint32
-		end   uint32
-	)
-
-	startEnd := map[uint32]uint32{}
-
-	for rows.Next() {
-		err = rows.Scan(&start, &end)
-		if err != nil {
-			return err
-		}
-
-		startEnd[start] = end
-	}
-
-	// Sort starting blocks lowest to highest, so we can properly fill timestamps
-	keys := make([]uint32, 0, len(startEnd))
-	for k := range startEnd {
-		keys = append(keys, k)
-	}
-	sort.Slice(keys, func(i, j int) bool {
-		return i < j
-	})
 
 	// Fill blocks
-	for _, startBlock := range keys {
+	for _, gap := range gaps {
+		startBlock := gap.Start
 		// Ensure we don't request too many blocks at once and kill the node RPC
-		endBlock := startEnd[startBlock] + 1 // end is not inclusive in this func, so adding 1
+		endBlock := gap.End + 1 // end is not inclusive in this func, so adding 1
 		start := endBlock - m.rpcPerPage
 
 		for {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
 			if start < startBlock {
 				start = startBlock
 			}
 			log.Printf("Fetching blocks between %d and %d\n", start, endBlock)
-			err = m.fetchAndSaveBlocksBetween(start, endBlock)
+			err = m.fetchAndSaveBlocksBetween(ctx, start, endBlock)
 			if err != nil {
 				return err
 			}
@@ -169,57 +67,37 @@ func (m *Metrics) FillBlockGaps() error {
 			endBlock = endBlock - m.rpcPerPage
 
 			// Fills any missing timestamps
-			err = m.FillTimestampGaps()
+			err = m.FillTimestampGaps(ctx)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return m.FillTimestampGaps()
+	return m.FillTimestampGaps(ctx)
 }
 
 // FillTimestampGaps In some cases, there might be blocks that for one reason or another, dont have a timestamp associated
 // This identifies those gaps, and adds the missing timestamps
-func (m *Metrics) FillTimestampGaps() error {
-	query := "select height from blocks where timestamp IS NULL order by height asc;"
-
-	var (
-		height uint32
-	)
-
-	rows, err := m.mysqlClient.Query(query)
+func (m *Metrics) FillTimestampGaps(ctx context.Context) error {
+	heights, err := m.store.GetHeightsMissingTimestamps(ctx)
 	if err != nil {
 		return err
 	}
 
-	for rows.Next() {
-		err = rows.Scan(&height)
+	for _, height := range heights {
+		timestamp := m.GetNonTXBlockTimestamp(ctx, height)
+		err = m.store.SetTimestamp(ctx, height, timestamp)
 		if err != nil {
 			return err
 		}
-
-		timestamp := m.GetNonTXBlockTimestamp(height)
-		insert, err := m.mysqlClient.Query("UPDATE blocks set timestamp=? where height=?;", timestamp, height)
-		if err != nil {
-			return err
-		}
-		err = insert.Close()
-		if err != nil {
-			return err
-		}
-	}
-
-	err = rows.Close()
-	if err != nil {
-		return err
 	}
 
 	return nil
 }
 
-// receiveBlock is the callback when we receive a block via a websocket subscription
-func (m *Metrics) receiveBlock(resp *types.WebsocketResponse) {
+// receiveBlock is the callback when we receive a block via a websocket subscription from the node
+func (m *Metrics) receiveBlock(ctx context.Context, node *fullNode, resp *types.WebsocketResponse) {
 	block := &types.BlockEvent{}
 	err := json.Unmarshal(resp.Data, block)
 	if err != nil {
@@ -228,31 +106,63 @@ func (m *Metrics) receiveBlock(resp *types.WebsocketResponse) {
 	}
 
 	if block.ReceiveBlockResult.OrElse(types.ReceiveBlockResultInvalidBlock) == types.ReceiveBlockResultNewPeak {
-		log.Printf("Received block %d\n", block.Height)
+		m.prometheusMetrics.nodePeakHeight.WithLabelValues(node.hostname).Set(float64(block.Height))
 
-		// The block event doesn't actually have the full block record, so grab it from the RPC
-		result, _, err := m.websocketClient.FullNodeService.GetBlockByHeight(&rpc.GetBlockByHeightOptions{BlockHeight: int(block.Height)})
-		if err != nil {
-			log.Errorf("Error getting block in response to webhook: %s\n", err.Error())
+		// Every node announces the same peaks, so only the first announcement is processed
+		if !m.claimPeak(block.HeaderHash) {
+			log.Debugf("Already received block %d from another node\n", block.Height)
 			return
 		}
+		log.Printf("Received block %d from %s\n", block.Height, node.hostname)
 
-		// result can sometimes be nil when the websocket message about a new block is from a node that is slightly
-		// ahead of the node that we request the block from
-		// In these cases, it should be relatively safe to skip the block, since the automatic backfill should
-		// get the block later
-		if result == nil || result.Block.IsAbsent() {
-			log.Errorf("Block was not present in the response")
-			return
-		}
+		m.processPeak(ctx, node, block.Height)
+	}
+}
 
-		err = m.saveBlock(result.Block.MustGet())
+// processPeak fetches and saves a new peak the node announced, rolling back any orphaned blocks first, and refreshes
+// the metrics. Any blocks between our newest block and the peak are fetched by the gap fill when the metrics refresh
+func (m *Metrics) processPeak(ctx context.Context, node *fullNode, height uint32) {
+	// The block event doesn't actually have the full block record, so grab it from the RPC
+	// The node that announced the block is asked first, since the other nodes may not have the block yet. If it
+	// can't answer, the other nodes are tried, and if none of them have it, the automatic backfill should get the
+	// block later
+	var (
+		fullBlock types.FullBlock
+		source    *fullNode
+	)
+	err := m.withNode(node, func(node *fullNode) error {
+		result, _, err := node.client.FullNodeService.GetBlockByHeight(&rpc.GetBlockByHeightOptions{BlockHeight: int(height)})
 		if err != nil {
-			log.Errorf("Error saving block: %s\n", err.Error())
-			return
+			return err
+		}
+		if result == nil || result.Block.IsAbsent() {
+			return fmt.Errorf("block %d was not present in the response", height)
 		}
+		fullBlock = result.Block.MustGet()
+		source = node
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error getting new peak block %d: %s\n", height, err.Error())
+		return
+	}
+
+	err = m.handleReorg(ctx, source, fullBlock)
+	if err != nil {
+		log.Errorf("Error checking for chain reorganization: %s\n", err.Error())
+		return
+	}
+
+	err = m.saveBlock(ctx, fullBlock)
+	if err != nil {
+		log.Errorf("Error saving block: %s\n", err.Error())
+		return
+	}
+
+	m.refreshMetrics(ctx, height)
 
-		m.refreshMetrics(block.Height)
+	if m.nodeConsensusCheck && len(m.nodes) > 1 {
+		m.checkNodeConsensus(source, fullBlock)
 	}
 }
 
@@ -262,71 +172,191 @@ func (m *Metrics) receiveBlock(resp *types.WebsocketResponse) {
 // The only case where we DONT process blocks in this order is the backfill --delete-first option, which goes backwards,
 // so there is useful data ASAP
 // For this case, the "fill missing timestamps" will catch and resolve the issue
-func (m *Metrics) GetNonTXBlockTimestamp(blockHeight uint32) sql.NullString {
-	query := "select timestamp from blocks " +
-		"where height < ? " +
-		"and height > ? " +
-		"and timestamp IS NOT NULL order by height desc limit 1;"
-
+func (m *Metrics) GetNonTXBlockTimestamp(ctx context.Context, blockHeight uint32) sql.NullTime {
 	// Constrain to 10 blocks older to make sure we aren't accidentally getting a very old timestamp
-	// Typically this is 5 or less from my observations, but this just allows a buffer, just in case
-	rows, err := m.mysqlClient.Query(query, blockHeight, blockHeight-10)
-	if err != nil {
-		return sql.NullString{}
+	var minHeight uint32
+	if blockHeight > nonTXTimestampDistance {
+		minHeight = blockHeight - nonTXTimestampDistance
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Errorf("Could not close rows: %s\n", err.Error())
-		}
-	}(rows)
 
-	var (
-		timestr string
-	)
-	rows.Next()
-	err = rows.Scan(&timestr)
+	timestamp, err := m.store.GetPrecedingTimestamp(ctx, blockHeight, minHeight)
 	if err != nil {
-		return sql.NullString{}
+		return sql.NullTime{}
 	}
 
-	return sql.NullString{
-		String: timestr,
-		Valid:  true,
-	}
+	return timestamp
 }
 
-func (m *Metrics) saveBlock(block types.FullBlock) error {
-	blockHeight := block.RewardChainBlock.Height
-	farmerPuzzHash := block.Foliage.FoliageBlockData.FarmerRewardPuzzleHash.String()
-	farmerAddress, _ := bech32m.EncodePuzzleHash(block.Foliage.FoliageBlockData.FarmerRewardPuzzleHash, "xch")
+// nonTXTimestampDistance is how far back to look for the TX block a non-TX block borrows its timestamp from
+// Typically this is 5 or less from my observations, but this just allows a buffer, just in case
+const nonTXTimestampDistance = 10
+
+// newBlockRecord converts the full block to the record we store in the DB, encoding the addresses with the prefix
+// Non-TX blocks don't have a timestamp on chain, so the timestamp is left for newBlockRecords to resolve
+func newBlockRecord(block types.FullBlock, addressPrefix string) (BlockRecord, error) {
+	farmerAddress, _ := bech32m.EncodePuzzleHash(block.Foliage.FoliageBlockData.FarmerRewardPuzzleHash, addressPrefix)
+	poolAddress, _ := bech32m.EncodePuzzleHash(block.Foliage.FoliageBlockData.PoolTarget.PuzzleHash, addressPrefix)
+	headerHash, err := headerHash(block)
+	if err != nil {
+		return BlockRecord{}, err
+	}
+
+	proofOfSpace := block.RewardChainBlock.ProofOfSpace
+	record := BlockRecord{
+		Height:           block.RewardChainBlock.Height,
+		TransactionBlock: block.FoliageTransactionBlock.IsPresent(),
+		FarmerPuzzleHash: block.Foliage.FoliageBlockData.FarmerRewardPuzzleHash.String(),
+		FarmerAddress:    farmerAddress,
+		HeaderHash:       headerHash.String(),
+		PrevHeaderHash:   block.Foliage.PrevBlockHash.String(),
+
+		Weight:               block.RewardChainBlock.Weight.String(),
+		TotalIters:           block.RewardChainBlock.TotalIters.String(),
+		SignagePointIndex:    block.RewardChainBlock.SignagePointIndex,
+		PoolTargetPuzzleHash: block.Foliage.FoliageBlockData.PoolTarget.PuzzleHash.String(),
+		PoolAddress:          poolAddress,
+		PlotPublicKey:        types.Bytes48(proofOfSpace.PlotPublicKey).String(),
+		KSize:                proofOfSpace.Size,
+	}
+	if proofOfSpace.PoolPublicKey.IsPresent() {
+		record.PoolPublicKey = nullString(types.Bytes48(proofOfSpace.PoolPublicKey.MustGet()).String())
+	}
+	if proofOfSpace.PoolContractPuzzleHash.IsPresent() {
+		record.PoolContractPuzzleHash = nullString(proofOfSpace.PoolContractPuzzleHash.MustGet().String())
+	}
 
-	var timestamp sql.NullString
 	if block.FoliageTransactionBlock.IsPresent() {
-		timestamp = sql.NullString{
-			String: block.FoliageTransactionBlock.MustGet().Timestamp.Format("2006-01-02 15:04:05"),
-			Valid:  true,
+		record.Timestamp = sql.NullTime{
+			Time:  block.FoliageTransactionBlock.MustGet().Timestamp.UTC(),
+			Valid: true,
 		}
-	} else {
-		timestamp = m.GetNonTXBlockTimestamp(blockHeight)
 	}
-	insert, err := m.mysqlClient.Query("INSERT INTO blocks (timestamp, height, transaction_block, farmer_puzzle_hash, farmer_address) VALUES(?, ?, ?, ?, ?)", timestamp, blockHeight, block.FoliageTransactionBlock.IsPresent(), farmerPuzzHash, farmerAddress)
+
+	if block.TransactionsInfo.IsPresent() {
+		info := block.TransactionsInfo.MustGet()
+		record.Transactions = &BlockTransactions{
+			Fees:         info.Fees,
+			Cost:         info.Cost,
+			RewardClaims: uint32(len(info.RewardClaimsIncorporated)),
+		}
+		for _, claim := range info.RewardClaimsIncorporated {
+			record.Transactions.RewardClaimsAmount += claim.Amount
+		}
+	}
+
+	return record, nil
+}
+
+// countAdditionsAndRemovals sets the number of coins created and spent by the transactions in the block on the record
+// The full block only has the generator program, so the counts come from the full node, or the full node database when
+// one is open. Blocks without a generator don't have any transactions, so there is nothing to count
+func (m *Metrics) countAdditionsAndRemovals(ctx context.Context, block types.FullBlock, record *BlockRecord) error {
+	if record.Transactions == nil {
+		return nil
+	}
+	if block.TransactionsGenerator.IsAbsent() {
+		record.Transactions.CoinsCounted = true
+		return nil
+	}
+	if m.nodeDB != nil {
+		return m.nodeDB.countAdditionsAndRemovals(ctx, record)
+	}
+
+	hash, err := headerHash(block)
 	if err != nil {
 		return err
 	}
-	err = insert.Close()
-	if err != nil {
+	var coins *rpc.GetAdditionsAndRemovalsResponse
+	err = m.withNode(nil, func(node *fullNode) error {
+		var err error
+		coins, _, err = node.rpcClient.FullNodeService.GetAdditionsAndRemovals(&rpc.GetAdditionsAndRemovalsOptions{HeaderHash: hash})
 		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error getting additions and removals for block %d: %w", record.Height, err)
+	}
+
+	// Additions include the reward coins, which aren't part of the transactions
+	for _, addition := range coins.Additions {
+		if !addition.Coinbase {
+			record.Transactions.Additions++
+		}
 	}
+	record.Transactions.Removals = uint32(len(coins.Removals))
+	record.Transactions.CoinsCounted = true
 
 	return nil
 }
 
+// newBlockRecords converts the full blocks to the records we store in the DB, lowest height first
+// Non-TX blocks borrow the timestamp of the preceding TX block in the batch. Only the non-TX blocks before the first TX
+// block in the batch need to look up the timestamp in the DB
+// Counting the coins takes a request per transaction block, so countCoins is only set for batches when count-coins is
+// enabled. The fees and cost are always stored, since they are in the full block
+func (m *Metrics) newBlockRecords(ctx context.Context, blocks []types.FullBlock, countCoins bool) ([]BlockRecord, error) {
+	records := make([]BlockRecord, 0, len(blocks))
+	for _, block := range blocks {
+		record, err := newBlockRecord(block, m.network.AddressPrefix)
+		if err != nil {
+			return nil, err
+		}
+		if countCoins {
+			err = m.countAdditionsAndRemovals(ctx, block, &record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Height < records[j].Height
+	})
+
+	var lastTX *BlockRecord
+	for i := range records {
+		if records[i].TransactionBlock {
+			lastTX = &records[i]
+			continue
+		}
+		if lastTX == nil {
+			records[i].Timestamp = m.GetNonTXBlockTimestamp(ctx, records[i].Height)
+			continue
+		}
+		if records[i].Height-lastTX.Height < nonTXTimestampDistance {
+			records[i].Timestamp = lastTX.Timestamp
+		}
+	}
+
+	return records, nil
+}
+
+// countCoinsInBatches returns whether to count the coins for blocks saved in batches. The full node database has the
+// coin records locally, so they are always counted when reading from it
+func (m *Metrics) countCoinsInBatches() bool {
+	return m.countCoins || m.nodeDB != nil
+}
+
+// saveBlock saves a new peak. There is only one block, so the coins are always counted
+func (m *Metrics) saveBlock(ctx context.Context, block types.FullBlock) error {
+	return m.saveBlocks(ctx, []types.FullBlock{block}, true)
+}
+
+// saveBlocks saves all the blocks in a single transaction
+func (m *Metrics) saveBlocks(ctx context.Context, blocks []types.FullBlock, countCoins bool) error {
+	records, err := m.newBlockRecords(ctx, blocks, countCoins)
+	if err != nil {
+		return err
+	}
+
+	return m.store.SaveBlocks(ctx, records)
+}
+
 // refreshMetrics updates the metrics using the provided peak height as a starting point to look back from
-func (m *Metrics) refreshMetrics(peakHeight uint32) {
+func (m *Metrics) refreshMetrics(ctx context.Context, peakHeight uint32) {
 	// Update the highest block we've seen, if this is larger
 	m.peakLock.Lock()
 	if peakHeight <= m.highestPeak {
+		m.peakLock.Unlock()
 		return
 	}
 	m.highestPeak = peakHeight
@@ -341,123 +371,65 @@ func (m *Metrics) refreshMetrics(peakHeight uint32) {
 		return
 	}
 
-	err := m.FillBlockGaps()
+	m.calculateMetrics(ctx, peakHeight)
+}
+
+// calculateMetrics calculates every metric for the peak height. The caller must hold the refreshing lock
+func (m *Metrics) calculateMetrics(ctx context.Context, peakHeight uint32) {
+	settings := m.config()
+
+	err := m.FillBlockGaps(ctx)
 	if err != nil {
 		log.Errorf("error backfilling gaps: %s\n", err.Error())
 		return
 	}
 
-	nakamoto50, err := m.CalculateNakamoto(peakHeight, 50, []string{})
-	if err != nil {
-		log.Errorf("Error calculating 50%% threshold nakamoto coefficient: %s\n", err.Error())
-		return
+	for _, window := range settings.lookbackWindows {
+		m.refreshWindowNakamoto(ctx, settings, peakHeight, window)
 	}
+	for _, duration := range settings.lookbackDurations {
+		m.refreshDurationNakamoto(ctx, settings, peakHeight, duration)
+	}
+	m.refreshTransactionMetrics(ctx, settings, peakHeight)
+	m.refreshPoolMetrics(ctx, settings, peakHeight)
 
-	nakamoto51, err := m.CalculateNakamoto(peakHeight, 51, []string{})
+	// The rest of the metrics are calculated from the primary lookback window, so only update them once it's ready
+	distribution, err := settings.engine.distribution([]string{})
 	if err != nil {
-		log.Errorf("Error calculating 51%% threshold nakamoto coefficient: %s\n", err.Error())
+		log.Errorf("Error getting the farmer distribution: %s\n", err.Error())
 		return
 	}
+	m.prometheusMetrics.blockHeight.Set(float64(peakHeight))
+	m.setTopFarmers(m.labelRanks(rankFarmers(distribution, settings.lookbackWindow, 0, settings.topFarmersCount)))
 
-	nakamoto50Adj, err := m.CalculateNakamoto(peakHeight, 50, viper.GetStringSlice("adjusted-ignore-addresses"))
+	indices, err := decentralizationIndices(distribution)
 	if err != nil {
-		log.Errorf("Error calculating 50%% threshold adjusted nakamoto coefficient: %s\n", err.Error())
-		return
+		log.Errorf("Error calculating decentralization indices: %s\n", err.Error())
+	} else {
+		m.setIndices(indices, false)
 	}
 
-	nakamoto51Adj, err := m.CalculateNakamoto(peakHeight, 51, viper.GetStringSlice("adjusted-ignore-addresses"))
+	adjustedDistribution, err := settings.engine.distribution(m.adjustedIgnoreAddresses(settings))
 	if err != nil {
-		log.Errorf("Error calculating 51%% threshold adjusted nakamoto coefficient: %s\n", err.Error())
+		log.Errorf("Error getting the adjusted farmer distribution: %s\n", err.Error())
 		return
 	}
-
-	m.prometheusMetrics.nakamotoCoefficient50.Set(float64(nakamoto50))
-	m.prometheusMetrics.nakamotoCoefficient51.Set(float64(nakamoto51))
-	m.prometheusMetrics.nakamotoCoefficient50Adjusted.Set(float64(nakamoto50Adj))
-	m.prometheusMetrics.nakamotoCoefficient51Adjusted.Set(float64(nakamoto51Adj))
-	m.prometheusMetrics.blockHeight.Set(float64(peakHeight))
-}
-
-// CalculateNakamoto calculates the NC for the given peak height and percentage
-func (m *Metrics) CalculateNakamoto(peakHeight uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
-	lookbackWindowPercent := float64(m.lookbackWindow) / 100
-	minHeight := peakHeight - m.lookbackWindow
-
-	// First, make sure we actually have enough blocks in the lookback window to do accurate math
-	// Otherwise, just return an error (assume we are still syncing block history over)
-	countQuery := "select count(*) from blocks where height > ?"
-	countRow := m.mysqlClient.QueryRow(countQuery, minHeight)
-	var count uint32
-	err := countRow.Scan(&count)
+	adjustedIndices, err := decentralizationIndices(adjustedDistribution)
 	if err != nil {
-		return 0, err
-	}
-	if count < m.lookbackWindow {
-		return 0, fmt.Errorf("do not have %d blocks in database to use for nakamoto coefficient calculation", m.lookbackWindow)
-	}
-
-	//if ignoreAddresses is nothing, just add an empty string
-	if len(ignoreAddresses) == 0 {
-		ignoreAddresses = append(ignoreAddresses, "")
-	}
-	query := "select number, cumulative_percent from ( " +
-		"select " +
-		"        row_number() over (order by count(*) desc, farmer_address asc) as number, " +
-		"        farmer_address, " +
-		"        count(*) as count, " +
-		"        sum(count(*)) over (order by count(*) desc, farmer_address asc) as cumulative_count, " +
-		"        count(*)/? as percent, " +
-		"        sum(count(*)) over (order by count(*) desc, farmer_address asc) / ? as cumulative_percent " +
-		"    from blocks where height > ? and height <= ? and farmer_address NOT IN (?" + strings.Repeat(",?", len(ignoreAddresses)-1) + ") group by farmer_address order by count DESC, farmer_address ASC limit 1000 " +
-		") as intermediary " +
-		"where cumulative_percent >= ? order by cumulative_percent asc, number asc limit 1;"
-	// 1: lookbackWindowPercent
-	// 2: lookbackWindowPercent
-	// 3: minHeight
-	// 4: peakHeight
-	// 5: Ignore Addresses...
-	// 6: thresholdPercent
-	args := []interface{}{lookbackWindowPercent, lookbackWindowPercent, minHeight, peakHeight}
-	for _, _ignore := range ignoreAddresses {
-		args = append(args, _ignore)
-	}
-	args = append(args, thresholdPercent)
-	row := m.mysqlClient.QueryRow(query, args...)
-
-	var (
-		number            int
-		cumulativePercent float64
-	)
-	err = row.Scan(&number, &cumulativePercent)
-	if err != nil {
-		return 0, err
+		log.Errorf("Error calculating adjusted decentralization indices: %s\n", err.Error())
+	} else {
+		m.setIndices(adjustedIndices, true)
 	}
 
-	return number, nil
+	m.setEntityNakamoto(settings, distribution, adjustedDistribution)
 }
 
 // GetOldestBlock returns the oldest block height from the DB
-func (m *Metrics) GetOldestBlock() (uint32, error) {
-	countQuery := "select height from blocks order by height asc limit 1"
-	countRow := m.mysqlClient.QueryRow(countQuery)
-	var height uint32
-	err := countRow.Scan(&height)
-	if err != nil {
-		return 0, err
-	}
-
-	return height, nil
+func (m *Metrics) GetOldestBlock(ctx context.Context) (uint32, error) {
+	return m.store.GetOldestBlock(ctx)
 }
 
 // GetNewestBlock returns the newest block height from the DB
-func (m *Metrics) GetNewestBlock() (uint32, error) {
-	countQuery := "select height from blocks order by height desc limit 1"
-	countRow := m.mysqlClient.QueryRow(countQuery)
-	var height uint32
-	err := countRow.Scan(&height)
-	if err != nil {
-		return 0, err
-	}
-
-	return height, nil
+func (m *Metrics) GetNewestBlock(ctx context.Context) (uint32, error) {
+	return m.store.GetNewestBlock(ctx)
 }
@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// settings are the options that can be changed while serve is running
+// A reload builds and validates a complete new set of settings and then swaps it in, so everything reading the
+// settings sees either the old set or the new set, never a mix of the two
+type settings struct {
+	lookbackWindow     uint32
+	topFarmersCount    int
+	nakamotoThresholds []int
+
+	// lookbackWindows is every window the NC is calculated for, starting with lookbackWindow
+	lookbackWindows []uint32
+
+	// lookbackDurations are the time based windows the NC is calculated for, in addition to the lookbackWindows
+	lookbackDurations []LookbackDuration
+
+	// transactionWindows are the windows, in blocks, the fee market metrics are calculated for
+	transactionWindows []uint32
+
+	ignoreAddresses  []string
+	ignoreCategories []string
+	crossCheck       bool
+	logLevel         log.Level
+
+	// apiMaxWindow is the largest window, in blocks, the JSON API will calculate metrics for
+	apiMaxWindow uint32
+
+	// engine is the in memory window for lookbackWindow. engines has one for each of the lookbackWindows
+	engine  *nakamotoEngine
+	engines map[uint32]*nakamotoEngine
+
+	// hash identifies the settings, so it is easy to tell which config each instance is running with
+	hash string
+}
+
+// loadSettings reads and validates the reloadable settings from viper
+// Engines for windows that were already in the previous settings are kept, so they don't need to be loaded again
+func loadSettings(lookbackWindow int, previous *settings) (*settings, error) {
+	var err error
+	if lookbackWindow <= 0 {
+		return nil, fmt.Errorf("lookback-window must be greater than 0")
+	}
+
+	s := &settings{
+		lookbackWindow:   uint32(lookbackWindow),
+		topFarmersCount:  viper.GetInt("top-farmers-count"),
+		ignoreAddresses:  viper.GetStringSlice("adjusted-ignore-addresses"),
+		ignoreCategories: viper.GetStringSlice("adjusted-ignore-categories"),
+		crossCheck:       viper.GetBool("nakamoto-cross-check"),
+		engines:          map[uint32]*nakamotoEngine{},
+	}
+
+	s.nakamotoThresholds, err = nakamotoThresholds(viper.GetIntSlice("nakamoto-thresholds"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.lookbackWindows, err = lookbackWindows(s.lookbackWindow, viper.GetIntSlice("lookback-windows"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.lookbackDurations, err = lookbackDurations(viper.GetStringSlice("lookback-durations"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.transactionWindows, err = transactionWindows(viper.GetIntSlice("transaction-windows"))
+	if err != nil {
+		return nil, err
+	}
+
+	apiMaxWindow := viper.GetInt("api-max-window")
+	if apiMaxWindow < lookbackWindow {
+		return nil, fmt.Errorf("api-max-window must be at least the lookback-window")
+	}
+	s.apiMaxWindow = uint32(apiMaxWindow)
+
+	err = ignoreCategories(s.ignoreCategories)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logLevel, err = log.ParseLevel(viper.GetString("log-level"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, window := range s.lookbackWindows {
+		if previous != nil && previous.engines[window] != nil {
+			s.engines[window] = previous.engines[window]
+			continue
+		}
+		s.engines[window] = newNakamotoEngine(window)
+	}
+	s.engine = s.engines[s.lookbackWindow]
+
+	s.hash = s.calculateHash()
+
+	return s, nil
+}
+
+// calculateHash returns a short hash of every setting
+func (s *settings) calculateHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%v|%v|%v|%v|%v|%v|%t|%s|%d",
+		s.lookbackWindow, s.topFarmersCount, s.nakamotoThresholds, s.lookbackWindows, s.lookbackDurations,
+		s.transactionWindows, s.ignoreAddresses, s.ignoreCategories, s.crossCheck, s.logLevel, s.apiMaxWindow)))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// config returns the current settings. Read it once and use the result, so the settings are consistent even if they
+// are reloaded part way through
+func (m *Metrics) config() *settings {
+	return m.settings.Load()
+}
+
+// applySettings swaps in the new settings
+func (m *Metrics) applySettings(s *settings) {
+	log.SetLevel(s.logLevel)
+	m.settings.Store(s)
+
+	m.prometheusMetrics.configInfo.Reset()
+	m.prometheusMetrics.configInfo.WithLabelValues(s.hash).Set(1)
+}
+
+// WatchConfig reloads the settings for every network whenever the config file changes, and recalculates the metrics
+// with them
+func (m *Metrics) WatchConfig() {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		// The event may be for the directory, when the file is a symlink that was swapped, such as a k8s configmap
+		m.reloadConfig(viper.ConfigFileUsed())
+	})
+	viper.WatchConfig()
+}
+
+// reloadConfig validates and applies the settings from the config file that changed for every network, and
+// recalculates their metrics for the current peak. An invalid config is logged and the previous settings are kept
+func (m *Metrics) reloadConfig(path string) {
+	// Editors often truncate the file before writing it, and an empty file would reset everything to the defaults
+	contents, err := os.ReadFile(path)
+	if err != nil || len(bytes.TrimSpace(contents)) == 0 {
+		return
+	}
+
+	if !m.startWork() {
+		return
+	}
+	defer m.inFlight.Done()
+
+	for _, network := range m.networks {
+		network.reloadSettings(path)
+	}
+}
+
+// reloadSettings loads the settings for this network and recalculates the metrics with them if they changed
+func (m *Metrics) reloadSettings(path string) {
+	// Hold the refresh lock, so a refresh that is running finishes with the settings it started with
+	m.refreshing.Lock()
+	defer m.refreshing.Unlock()
+
+	previous := m.config()
+	s, err := loadSettings(viper.GetInt("lookback-window"), previous)
+	if err != nil {
+		m.prometheusMetrics.configReloads.WithLabelValues("failure").Inc()
+		log.Errorf("Error reloading config from %s. Keeping the previous config: %s\n", path, err.Error())
+		return
+	}
+	m.prometheusMetrics.configReloads.WithLabelValues("success").Inc()
+	if s.hash == previous.hash {
+		log.Debugf("Config file %s changed, but the settings are the same\n", path)
+		return
+	}
+
+	m.applySettings(s)
+	log.Printf("Reloaded config from %s for %s. Config hash %s\n", path, m.network.Name, s.hash)
+
+	// Windows and thresholds may have been removed, so clear the labelled gauges before recalculating
+	m.resetLabelledGauges()
+
+	m.peakLock.Lock()
+	peakHeight := m.highestPeak
+	m.peakLock.Unlock()
+	if peakHeight > 0 {
+		m.calculateMetrics(m.workCtx, peakHeight)
+	}
+}
+
+// resetLabelledGauges removes every series from the gauges labelled by window or threshold
+func (m *Metrics) resetLabelledGauges() {
+	m.prometheusMetrics.nakamotoCoefficient.Reset()
+	m.prometheusMetrics.nakamotoCoefficientAdjusted.Reset()
+	m.prometheusMetrics.feesPerBlock.Reset()
+	m.prometheusMetrics.blockFullness.Reset()
+	m.prometheusMetrics.transactionsPerSecond.Reset()
+	m.prometheusMetrics.poolNakamotoCoefficient.Reset()
+	m.prometheusMetrics.entityNakamotoCoefficient.Reset()
+	m.prometheusMetrics.entityNakamotoCoefficientAdjusted.Reset()
+}
@@ -1,32 +1,73 @@
 package metrics
 
-// initTables ensures that the tables required exist and have the correct columns present
-func (m *Metrics) initTables() error {
-	query := "CREATE TABLE IF NOT EXISTS `blocks` (" +
-		"  `id` int unsigned NOT NULL AUTO_INCREMENT," +
-		"  `timestamp` DATETIME DEFAULT NULL," +
-		"  `height` int DEFAULT NULL," +
-		"  `transaction_block` tinyint(1) NOT NULL," +
-		"  `farmer_puzzle_hash` varchar(255) DEFAULT NULL," +
-		"  `farmer_address` varchar(255) DEFAULT NULL," +
-		"  PRIMARY KEY (`id`)," +
-		"UNIQUE KEY `height-unique` (`height`)," +
-		"KEY `height` (`height`)" +
-		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;"
-
-	result, err := m.mysqlClient.Query(query)
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DeleteBlockRecords deletes all records from the blocks table in the database
+func (m *Metrics) DeleteBlockRecords(ctx context.Context) error {
+	return m.store.DeleteBlocks(ctx)
+}
+
+// deleteBlocksFrom deletes all records at or above the given height from the blocks table
+func (m *Metrics) deleteBlocksFrom(ctx context.Context, height uint32) error {
+	return m.store.DeleteBlocksFrom(ctx, height)
+}
+
+// prepareSchema refuses to continue if the database schema is newer than this binary knows about, and applies any
+// pending migrations if auto migration is enabled
+// Without auto migration, pending migrations are an error, since the queries need the columns they add, unless
+// allowPending is set for the commands that manage the migrations
+func (m *Metrics) prepareSchema(ctx context.Context, autoMigrate bool, allowPending bool) error {
+	err := m.store.CheckSchemaVersion(ctx)
 	if err != nil {
 		return err
 	}
-	return result.Close()
+
+	if autoMigrate {
+		return m.MigrateUp(ctx)
+	}
+
+	statuses, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, fmt.Sprintf("%d %s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		if allowPending {
+			// The network column may not exist yet, so only assign the network once every migration is applied
+			return nil
+		}
+		return fmt.Errorf("database has pending migrations %s. Apply them with `block-metrics migrate up`, or enable auto-migrate", strings.Join(pending, ", "))
+	}
+
+	return m.store.AssignNetwork(ctx, m.network.AddressPrefix)
 }
 
-// DeleteBlockRecords deletes all records from the blocks table in the database
-func (m *Metrics) DeleteBlockRecords() error {
-	query := "DELETE from blocks;"
-	result, err := m.mysqlClient.Query(query)
+// MigrateUp applies all pending migrations, in order, then assigns the blocks saved before blocks were stored with their
+// network to the network in the chia config
+func (m *Metrics) MigrateUp(ctx context.Context) error {
+	err := m.store.MigrateUp(ctx)
 	if err != nil {
 		return err
 	}
-	return result.Close()
+
+	return m.store.AssignNetwork(ctx, m.network.AddressPrefix)
+}
+
+// MigrateDown rolls back the most recently applied migrations
+func (m *Metrics) MigrateDown(ctx context.Context, steps int) error {
+	return m.store.MigrateDown(ctx, steps)
+}
+
+// MigrationStatus returns every known migration and whether it has been applied
+func (m *Metrics) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return m.store.MigrationStatus(ctx)
 }
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// nakamotoEngine keeps the number of blocks each farmer address won in the lookback window in memory
+// Each new peak adds the new blocks and evicts the blocks that fell out of the window, so the metrics can be
+// calculated from the per address counts, instead of aggregating the whole window in the DB for every block
+type nakamotoEngine struct {
+	lock sync.RWMutex
+
+	windowSize uint32
+	peak       uint32
+	loaded     bool
+
+	// farmers is the farmer address for each height in the window
+	farmers map[uint32]string
+
+	// counts is the number of blocks each farmer address won in the window
+	counts map[string]uint32
+}
+
+func newNakamotoEngine(windowSize uint32) *nakamotoEngine {
+	return &nakamotoEngine{
+		windowSize: windowSize,
+		farmers:    map[uint32]string{},
+		counts:     map[string]uint32{},
+	}
+}
+
+// reset discards the window, so it is reloaded from the DB on the next advance
+// Used when blocks in the window are no longer valid, such as after a chain reorganization
+func (e *nakamotoEngine) reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.loaded = false
+}
+
+// advance moves the window so that it ends at peakHeight
+func (e *nakamotoEngine) advance(ctx context.Context, store BlockStore, peakHeight uint32) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// Reload everything if we don't have a complete window to build on, since gaps below the previous peak may have
+	// been filled since we last loaded, or if moving the window would replace all the blocks anyway
+	if !e.loaded || !e.full() || peakHeight < e.peak || peakHeight-e.peak >= e.windowSize {
+		return e.load(ctx, store, peakHeight)
+	}
+	if peakHeight == e.peak {
+		return nil
+	}
+
+	blocks, err := store.GetBlockFarmers(ctx, e.peak, peakHeight)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		e.add(block)
+	}
+
+	// Evict the blocks that are no longer in the window
+	for height := e.peak - e.windowSize + 1; height <= peakHeight-e.windowSize; height++ {
+		e.remove(height)
+	}
+	e.peak = peakHeight
+
+	return nil
+}
+
+// load replaces the window with the blocks from the DB ending at peakHeight
+func (e *nakamotoEngine) load(ctx context.Context, store BlockStore, peakHeight uint32) error {
+	e.farmers = map[uint32]string{}
+	e.counts = map[string]uint32{}
+	e.peak = peakHeight
+	e.loaded = false
+
+	var minHeight uint32
+	if peakHeight > e.windowSize {
+		minHeight = peakHeight - e.windowSize
+	}
+	blocks, err := store.GetBlockFarmers(ctx, minHeight, peakHeight)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		e.add(block)
+	}
+	e.loaded = true
+
+	return nil
+}
+
+func (e *nakamotoEngine) add(block BlockFarmer) {
+	if _, ok := e.farmers[block.Height]; ok {
+		return
+	}
+	e.farmers[block.Height] = block.FarmerAddress
+	if block.FarmerAddress != "" {
+		e.counts[block.FarmerAddress]++
+	}
+}
+
+func (e *nakamotoEngine) remove(height uint32) {
+	address, ok := e.farmers[height]
+	if !ok {
+		return
+	}
+	delete(e.farmers, height)
+	if address == "" {
+		return
+	}
+	e.counts[address]--
+	if e.counts[address] == 0 {
+		delete(e.counts, address)
+	}
+}
+
+// full returns true if every block in the window is present
+// Matches the SQL path, which requires the peak to be at least one full window above the start of the chain
+func (e *nakamotoEngine) full() bool {
+	return e.peak >= e.windowSize && uint32(len(e.farmers)) >= e.windowSize
+}
+
+// distribution returns the number of blocks each farmer address won in the window, excluding ignoreAddresses
+// Sorted by number of blocks descending, then farmer address ascending
+func (e *nakamotoEngine) distribution(ignoreAddresses []string) ([]FarmerBlocks, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	if !e.loaded || !e.full() {
+		return nil, notEnoughBlocksError{lookbackWindow: e.windowSize}
+	}
+
+	ignore := map[string]bool{}
+	for _, address := range ignoreAddresses {
+		ignore[address] = true
+	}
+
+	distribution := make([]FarmerBlocks, 0, len(e.counts))
+	for address, count := range e.counts {
+		if ignore[address] {
+			continue
+		}
+		distribution = append(distribution, FarmerBlocks{FarmerAddress: address, Blocks: count})
+	}
+	sortDistribution(distribution)
+
+	return distribution, nil
+}
+
+// sortDistribution sorts by number of blocks descending, then farmer address ascending, to match the DB ordering
+func sortDistribution(distribution []FarmerBlocks) {
+	sort.Slice(distribution, func(i, j int) bool {
+		if distribution[i].Blocks != distribution[j].Blocks {
+			return distribution[i].Blocks > distribution[j].Blocks
+		}
+		return distribution[i].FarmerAddress < distribution[j].FarmerAddress
+	})
+}
@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Entity is a named operator and the farmer addresses it farms to
+type Entity struct {
+	Name      string
+	Addresses []string
+}
+
+// EntityRegistry maps farmer addresses to the entity that operates them, so operators that farm to several addresses
+// are counted once in the entity aware NC
+// The registry is stored in a YAML file, with each entity name mapped to a list of addresses, or a CSV file with
+// address and entity columns
+type EntityRegistry struct {
+	lock *sync.RWMutex
+
+	// entities maps each address to its entity name
+	entities map[string]string
+}
+
+// NewEntityRegistry returns an empty entity registry
+func NewEntityRegistry() *EntityRegistry {
+	return &EntityRegistry{
+		lock:     &sync.RWMutex{},
+		entities: map[string]string{},
+	}
+}
+
+// LoadEntityRegistry loads the entity registry from a .yaml, .yml or .csv file
+func LoadEntityRegistry(path string) (*EntityRegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	registry := NewEntityRegistry()
+	if isCSV(path) {
+		err = registry.readCSV(file)
+	} else {
+		err = registry.readYAML(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading entities file %s: %w", path, err)
+	}
+
+	return registry, nil
+}
+
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+func (r *EntityRegistry) readYAML(reader io.Reader) error {
+	entities := map[string][]string{}
+	err := yaml.NewDecoder(reader).Decode(&entities)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	for name, addresses := range entities {
+		for _, address := range addresses {
+			err = r.Set(address, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *EntityRegistry) readCSV(reader io.Reader) error {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for i, row := range rows {
+		if len(row) != 2 {
+			return fmt.Errorf("line %d must have an address and an entity", i+1)
+		}
+		if i == 0 && row[0] == "address" {
+			continue
+		}
+		err = r.Set(row[0], row[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Save writes the entity registry to a .yaml, .yml or .csv file
+func (r *EntityRegistry) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if isCSV(path) {
+		err = r.writeCSV(file)
+	} else {
+		err = r.writeYAML(file)
+	}
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error writing entities file %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+func (r *EntityRegistry) writeYAML(writer io.Writer) error {
+	entities := map[string][]string{}
+	for _, entity := range r.Entities() {
+		entities[entity.Name] = entity.Addresses
+	}
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	err := encoder.Encode(entities)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func (r *EntityRegistry) writeCSV(writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write([]string{"address", "entity"})
+	if err != nil {
+		return err
+	}
+	for _, entity := range r.Entities() {
+		for _, address := range entity.Addresses {
+			err = csvWriter.Write([]string{address, entity.Name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+// Set maps the address to the entity, replacing any entity the address was already mapped to
+func (r *EntityRegistry) Set(address string, entity string) error {
+	address = strings.TrimSpace(address)
+	entity = strings.TrimSpace(entity)
+	if address == "" || entity == "" {
+		return fmt.Errorf("address and entity must not be empty")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entities[address] = entity
+
+	return nil
+}
+
+// Remove removes the address from the registry. Returns false if the address wasn't in the registry
+func (r *EntityRegistry) Remove(address string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.entities[address]; !ok {
+		return false
+	}
+	delete(r.entities, address)
+
+	return true
+}
+
+// Entity returns the entity the address is mapped to. Unmapped addresses are their own entity, named by the address
+func (r *EntityRegistry) Entity(address string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if entity, ok := r.entities[address]; ok {
+		return entity
+	}
+	return address
+}
+
+// Entities returns every entity in the registry with its addresses, sorted by name
+func (r *EntityRegistry) Entities() []Entity {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	addresses := map[string][]string{}
+	for address, entity := range r.entities {
+		addresses[entity] = append(addresses[entity], address)
+	}
+
+	entities := make([]Entity, 0, len(addresses))
+	for name, entityAddresses := range addresses {
+		sort.Strings(entityAddresses)
+		entities = append(entities, Entity{Name: name, Addresses: entityAddresses})
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].Name < entities[j].Name
+	})
+
+	return entities
+}
+
+// groupByEntity combines the blocks won by the addresses of each entity, and returns the distribution sorted the same
+// as the farmer distribution, with the entity name in FarmerAddress
+func (r *EntityRegistry) groupByEntity(distribution []FarmerBlocks) []FarmerBlocks {
+	blocks := map[string]uint32{}
+	for _, farmer := range distribution {
+		blocks[r.Entity(farmer.FarmerAddress)] += farmer.Blocks
+	}
+
+	grouped := make([]FarmerBlocks, 0, len(blocks))
+	for entity, count := range blocks {
+		grouped = append(grouped, FarmerBlocks{FarmerAddress: entity, Blocks: count})
+	}
+	sortDistribution(grouped)
+
+	return grouped
+}
+
+// loadEntities loads the configured entities-file. Without one, every address is its own entity
+func loadEntities() (*EntityRegistry, error) {
+	path := viper.GetString("entities-file")
+	if path == "" {
+		return NewEntityRegistry(), nil
+	}
+
+	return LoadEntityRegistry(path)
+}
+
+// HasEntities returns true if an entities-file is configured
+func (m *Metrics) HasEntities() bool {
+	return viper.GetString("entities-file") != ""
+}
+
+// CalculateEntityNakamotoForWindow calculates the NC for the lookback window ending at the peak height, with the
+// addresses grouped by entity
+func (m *Metrics) CalculateEntityNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	distribution, err := m.GetFarmerDistribution(ctx, peakHeight, lookbackWindow, ignoreAddresses)
+	if err != nil {
+		return 0, err
+	}
+
+	return nakamotoCoefficient(m.entities.groupByEntity(distribution), lookbackWindow, thresholdPercent)
+}
+
+// setEntityNakamoto sets the entity aware NC gauges for every configured threshold from the primary lookback window
+// distributions
+func (m *Metrics) setEntityNakamoto(settings *settings, distribution []FarmerBlocks, adjustedDistribution []FarmerBlocks) {
+	grouped := m.entities.groupByEntity(distribution)
+	groupedAdjusted := m.entities.groupByEntity(adjustedDistribution)
+
+	for _, threshold := range settings.nakamotoThresholds {
+		nakamoto, err := nakamotoCoefficient(grouped, settings.lookbackWindow, threshold)
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold entity nakamoto coefficient: %s\n", threshold, err.Error())
+			return
+		}
+		nakamotoAdj, err := nakamotoCoefficient(groupedAdjusted, settings.lookbackWindow, threshold)
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold adjusted entity nakamoto coefficient: %s\n", threshold, err.Error())
+			return
+		}
+
+		thresholdLabel := strconv.Itoa(threshold)
+		m.prometheusMetrics.entityNakamotoCoefficient.WithLabelValues(thresholdLabel).Set(float64(nakamoto))
+		m.prometheusMetrics.entityNakamotoCoefficientAdjusted.WithLabelValues(thresholdLabel).Set(float64(nakamotoAdj))
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+)
+
+// FarmerRank is a farmer address's position in the lookback window, by number of blocks won
+type FarmerRank struct {
+	Rank          int
+	FarmerAddress string
+	Blocks        uint32
+	Percent       float64
+
+	// Label, Category and Notes are from the labels-file, when the address is labelled
+	Label    string
+	Category string
+	Notes    string
+}
+
+// GetTopFarmers returns the count farmer addresses that won the most blocks in the lookback window ending at the peak
+// height, excluding ignoreAddresses
+func (m *Metrics) GetTopFarmers(ctx context.Context, peakHeight uint32, lookbackWindow uint32, count int, ignoreAddresses []string) ([]FarmerRank, error) {
+	distribution, err := m.GetFarmerDistribution(ctx, peakHeight, lookbackWindow, ignoreAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.labelRanks(rankFarmers(distribution, lookbackWindow, 0, count)), nil
+}
+
+// rankFarmers returns up to count farmers from the distribution, skipping the first offset farmers
+// The distribution must be sorted by blocks won, descending. Percent is the share of all totalBlocks, so it lines up
+// with the nakamoto coefficient thresholds
+func rankFarmers(distribution []FarmerBlocks, totalBlocks uint32, offset int, count int) []FarmerRank {
+	ranks := []FarmerRank{}
+	for i := offset; i < len(distribution) && i < offset+count; i++ {
+		ranks = append(ranks, FarmerRank{
+			Rank:          i + 1,
+			FarmerAddress: distribution[i].FarmerAddress,
+			Blocks:        distribution[i].Blocks,
+			Percent:       float64(distribution[i].Blocks) / float64(totalBlocks) * 100,
+		})
+	}
+
+	return ranks
+}
+
+// setTopFarmers replaces the top farmer gauges with the given ranks, so addresses that dropped out are no longer exported
+func (m *Metrics) setTopFarmers(ranks []FarmerRank) {
+	m.prometheusMetrics.topFarmerBlocks.Reset()
+	m.prometheusMetrics.topFarmerPercent.Reset()
+	m.prometheusMetrics.topFarmerRank.Reset()
+	m.prometheusMetrics.topFarmerInfo.Reset()
+
+	for _, rank := range ranks {
+		m.prometheusMetrics.topFarmerBlocks.WithLabelValues(rank.FarmerAddress).Set(float64(rank.Blocks))
+		m.prometheusMetrics.topFarmerPercent.WithLabelValues(rank.FarmerAddress).Set(rank.Percent)
+		m.prometheusMetrics.topFarmerRank.WithLabelValues(rank.FarmerAddress).Set(float64(rank.Rank))
+		if rank.Label != "" || rank.Category != "" {
+			m.prometheusMetrics.topFarmerInfo.WithLabelValues(rank.FarmerAddress, rank.Label, rank.Category).Set(1)
+		}
+	}
+}
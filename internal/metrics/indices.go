@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DecentralizationIndices are measures of how evenly blocks are spread between farmers, in addition to the NC
+// Each is calculated from the share of the blocks won by the farmers in the distribution, so blocks won by ignored or
+// unknown addresses are left out entirely
+type DecentralizationIndices struct {
+	// Gini is the Gini coefficient of the blocks won by each farmer. 0 when every farmer won the same number of blocks,
+	// approaching 1 as one farmer wins everything
+	Gini float64
+
+	// HHI is the Herfindahl-Hirschman Index, the sum of the squared shares. From 1/farmers up to 1 for a single farmer
+	HHI float64
+
+	// Shannon is the Shannon entropy of the shares, in nats
+	Shannon float64
+
+	// EffectiveFarmers is the number of farmers with equal shares that would have the same Shannon entropy
+	EffectiveFarmers float64
+
+	// Theil is the Theil T index. 0 when every farmer won the same number of blocks, up to ln(farmers)
+	Theil float64
+}
+
+// CalculateIndices calculates the decentralization indices for the lookback window ending at the peak height
+func (m *Metrics) CalculateIndices(ctx context.Context, peakHeight uint32, ignoreAddresses []string) (DecentralizationIndices, error) {
+	distribution, err := m.GetFarmerDistribution(ctx, peakHeight, m.LookbackWindow(), ignoreAddresses)
+	if err != nil {
+		return DecentralizationIndices{}, err
+	}
+
+	return decentralizationIndices(distribution)
+}
+
+// decentralizationIndices calculates the decentralization indices for the distribution of blocks won
+func decentralizationIndices(distribution []FarmerBlocks) (DecentralizationIndices, error) {
+	var total uint64
+	blocks := make([]float64, 0, len(distribution))
+	for _, farmer := range distribution {
+		if farmer.Blocks == 0 {
+			continue
+		}
+		total += uint64(farmer.Blocks)
+		blocks = append(blocks, float64(farmer.Blocks))
+	}
+	if total == 0 {
+		return DecentralizationIndices{}, fmt.Errorf("no blocks won by farmers in the lookback window")
+	}
+
+	var indices DecentralizationIndices
+	farmers := float64(len(blocks))
+
+	for _, won := range blocks {
+		share := won / float64(total)
+		indices.HHI += share * share
+		indices.Shannon -= share * math.Log(share)
+	}
+	indices.EffectiveFarmers = math.Exp(indices.Shannon)
+	indices.Theil = math.Max(math.Log(farmers)-indices.Shannon, 0)
+
+	// With the blocks sorted ascending, G = 2 * sum(i * x_i) / (n * sum(x)) - (n + 1) / n, with i starting at 1
+	sort.Float64s(blocks)
+	var weighted float64
+	for i, won := range blocks {
+		weighted += float64(i+1) * won
+	}
+	indices.Gini = 2*weighted/(farmers*float64(total)) - (farmers+1)/farmers
+
+	return indices, nil
+}
+
+// setIndices sets the decentralization index gauges, either the adjusted or the unadjusted set
+func (m *Metrics) setIndices(indices DecentralizationIndices, adjusted bool) {
+	if adjusted {
+		m.prometheusMetrics.giniAdjusted.Set(indices.Gini)
+		m.prometheusMetrics.hhiAdjusted.Set(indices.HHI)
+		m.prometheusMetrics.shannonAdjusted.Set(indices.Shannon)
+		m.prometheusMetrics.effectiveFarmersAdjusted.Set(indices.EffectiveFarmers)
+		m.prometheusMetrics.theilAdjusted.Set(indices.Theil)
+		return
+	}
+
+	m.prometheusMetrics.gini.Set(indices.Gini)
+	m.prometheusMetrics.hhi.Set(indices.HHI)
+	m.prometheusMetrics.shannon.Set(indices.Shannon)
+	m.prometheusMetrics.effectiveFarmers.Set(indices.EffectiveFarmers)
+	m.prometheusMetrics.theil.Set(indices.Theil)
+}
@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// The categories an address label can have
+const (
+	LabelCategoryPool       = "pool"
+	LabelCategoryExchange   = "exchange"
+	LabelCategoryDevFee     = "dev-fee"
+	LabelCategoryIndividual = "individual"
+)
+
+var labelCategories = []string{LabelCategoryPool, LabelCategoryExchange, LabelCategoryDevFee, LabelCategoryIndividual}
+
+// AddressLabel is a human readable label for an address
+type AddressLabel struct {
+	Address  string `mapstructure:"address"`
+	Label    string `mapstructure:"label"`
+	Category string `mapstructure:"category"`
+	Notes    string `mapstructure:"notes"`
+}
+
+// LabelRegistry holds the address labels from the labels-file
+// The file is read with its own viper instance, so it can be watched and reloaded without restarting
+type LabelRegistry struct {
+	lock   *sync.RWMutex
+	labels map[string]AddressLabel
+
+	// config is the viper instance for the labels file. nil when no labels-file is configured
+	config *viper.Viper
+}
+
+// NewLabelRegistry returns an empty label registry
+func NewLabelRegistry() *LabelRegistry {
+	return &LabelRegistry{
+		lock:   &sync.RWMutex{},
+		labels: map[string]AddressLabel{},
+	}
+}
+
+// LoadLabelRegistry loads the address labels from a YAML or JSON file, with the format picked by the file extension
+func LoadLabelRegistry(path string) (*LabelRegistry, error) {
+	registry := NewLabelRegistry()
+	registry.config = viper.New()
+	registry.config.SetConfigFile(path)
+
+	err := registry.config.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading labels file %s: %w", path, err)
+	}
+
+	err = registry.reload()
+	if err != nil {
+		return nil, fmt.Errorf("error reading labels file %s: %w", path, err)
+	}
+
+	return registry, nil
+}
+
+// reload replaces the labels with the ones currently in the config. The labels are left as they were if any are invalid
+func (r *LabelRegistry) reload() error {
+	var configured []AddressLabel
+	err := r.config.UnmarshalKey("labels", &configured)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]AddressLabel{}
+	for i, label := range configured {
+		label.Address = strings.TrimSpace(label.Address)
+		if label.Address == "" {
+			return fmt.Errorf("label %d is missing the address", i+1)
+		}
+		if label.Category != "" && !isLabelCategory(label.Category) {
+			return fmt.Errorf("invalid category %s for %s. Must be one of %s", label.Category, label.Address, strings.Join(labelCategories, ", "))
+		}
+		labels[label.Address] = label
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.labels = labels
+
+	return nil
+}
+
+// Watch reloads the labels whenever the labels file changes. Invalid edits are logged and the previous labels are kept
+func (r *LabelRegistry) Watch() {
+	if r.config == nil {
+		return
+	}
+
+	r.config.OnConfigChange(func(event fsnotify.Event) {
+		// Editors often truncate the file before writing it, so an empty read is skipped until the write is done
+		// An intentionally empty file has an empty labels list
+		if !r.config.IsSet("labels") {
+			return
+		}
+		err := r.reload()
+		if err != nil {
+			log.Errorf("Error reloading labels file %s: %s\n", event.Name, err.Error())
+			return
+		}
+		log.Printf("Reloaded %d address labels from %s\n", r.Len(), event.Name)
+	})
+	r.config.WatchConfig()
+}
+
+// Label returns the label for the address, if it has one
+func (r *LabelRegistry) Label(address string) (AddressLabel, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	label, ok := r.labels[address]
+	return label, ok
+}
+
+// Len returns the number of labelled addresses
+func (r *LabelRegistry) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return len(r.labels)
+}
+
+// AddressesInCategories returns the labelled addresses in any of the categories, sorted
+func (r *LabelRegistry) AddressesInCategories(categories []string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var addresses []string
+	for address, label := range r.labels {
+		for _, category := range categories {
+			if label.Category == category {
+				addresses = append(addresses, address)
+				break
+			}
+		}
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func isLabelCategory(category string) bool {
+	for _, valid := range labelCategories {
+		if category == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreCategories validates the configured adjusted-ignore-categories
+func ignoreCategories(configured []string) error {
+	for _, category := range configured {
+		if !isLabelCategory(category) {
+			return fmt.Errorf("invalid adjusted ignore category %s. Must be one of %s", category, strings.Join(labelCategories, ", "))
+		}
+	}
+	return nil
+}
+
+// loadLabels loads the configured labels-file. Without one, no addresses are labelled
+func loadLabels() (*LabelRegistry, error) {
+	path := viper.GetString("labels-file")
+	if path == "" {
+		return NewLabelRegistry(), nil
+	}
+
+	return LoadLabelRegistry(path)
+}
+
+// WatchLabels reloads the address labels whenever the labels-file changes, so edits apply without a restart
+func (m *Metrics) WatchLabels() {
+	m.labels.Watch()
+}
+
+// AdjustedIgnoreAddresses returns the addresses the adjusted figures leave out. These are the adjusted-ignore-addresses
+// plus any labelled addresses in the adjusted-ignore-categories
+func (m *Metrics) AdjustedIgnoreAddresses() []string {
+	return m.adjustedIgnoreAddresses(m.config())
+}
+
+func (m *Metrics) adjustedIgnoreAddresses(settings *settings) []string {
+	addresses := append([]string{}, settings.ignoreAddresses...)
+	seen := map[string]bool{}
+	for _, address := range addresses {
+		seen[address] = true
+	}
+	for _, address := range m.labels.AddressesInCategories(settings.ignoreCategories) {
+		if !seen[address] {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// labelRanks fills in the labels of the ranked farmer addresses
+func (m *Metrics) labelRanks(ranks []FarmerRank) []FarmerRank {
+	for i := range ranks {
+		if label, ok := m.labels.Label(ranks[i].FarmerAddress); ok {
+			ranks[i].Label = label.Label
+			ranks[i].Category = label.Category
+			ranks[i].Notes = label.Notes
+		}
+	}
+	return ranks
+}
@@ -1,15 +1,14 @@
 package metrics
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"net/url"
+	"net/http"
 	"sync"
-	"time"
+	"sync/atomic"
 
-	"github.com/chia-network/go-chia-libs/pkg/rpc"
+	"github.com/chia-network/go-chia-libs/pkg/types"
 	wrappedPrometheus "github.com/chia-network/go-modules/pkg/prometheus"
-	"github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 )
@@ -22,99 +21,201 @@ type prometheusMetrics struct {
 	nakamotoCoefficient50Adjusted *wrappedPrometheus.LazyGauge
 	nakamotoCoefficient51Adjusted *wrappedPrometheus.LazyGauge
 
+	nakamotoCoefficient         *prometheus.GaugeVec
+	nakamotoCoefficientAdjusted *prometheus.GaugeVec
+
+	gini             *wrappedPrometheus.LazyGauge
+	hhi              *wrappedPrometheus.LazyGauge
+	shannon          *wrappedPrometheus.LazyGauge
+	effectiveFarmers *wrappedPrometheus.LazyGauge
+	theil            *wrappedPrometheus.LazyGauge
+
+	giniAdjusted             *wrappedPrometheus.LazyGauge
+	hhiAdjusted              *wrappedPrometheus.LazyGauge
+	shannonAdjusted          *wrappedPrometheus.LazyGauge
+	effectiveFarmersAdjusted *wrappedPrometheus.LazyGauge
+	theilAdjusted            *wrappedPrometheus.LazyGauge
+
 	blockHeight *wrappedPrometheus.LazyGauge
+
+	reorgCount prometheus.Counter
+	reorgDepth *wrappedPrometheus.LazyGauge
+
+	topFarmerBlocks  *prometheus.GaugeVec
+	topFarmerPercent *prometheus.GaugeVec
+	topFarmerRank    *prometheus.GaugeVec
+	topFarmerInfo    *prometheus.GaugeVec
+
+	feesPerBlock          *prometheus.GaugeVec
+	blockFullness         *prometheus.GaugeVec
+	transactionsPerSecond *prometheus.GaugeVec
+
+	poolNakamotoCoefficient *prometheus.GaugeVec
+	topPoolsPercent         *wrappedPrometheus.LazyGauge
+	poolHHI                 *wrappedPrometheus.LazyGauge
+	plotTypePercent         *prometheus.GaugeVec
+
+	entityNakamotoCoefficient         *prometheus.GaugeVec
+	entityNakamotoCoefficientAdjusted *prometheus.GaugeVec
+
+	configReloads *prometheus.CounterVec
+	configInfo    *prometheus.GaugeVec
+
+	activeNode              *prometheus.GaugeVec
+	nodeHealthy             *prometheus.GaugeVec
+	nodePeakHeight          *prometheus.GaugeVec
+	nodeRequestFailures     *prometheus.CounterVec
+	nodeConsensusMismatches *prometheus.CounterVec
 }
 
 // Metrics deals with the block db and metrics
 type Metrics struct {
 	exporterPort uint16
 
-	dbHost string
-	dbPort uint16
-	dbUser string
-	dbPass string
-	dbName string
+	dbDriver string
+	dbHost   string
+	dbPort   uint16
+	dbUser   string
+	dbPass   string
+	dbName   string
 
-	websocketClient *rpc.Client
+	// network is the chia network this instance tracks. Every metric is labelled with it
+	network Network
 
-	mysqlClient *sql.DB
+	// networks are the metrics for every network serve tracks, starting with this one. Only set on the first network,
+	// which runs the metrics server and config reloads for all of them
+	networks []*Metrics
+
+	// nodes are the configured full nodes. Requests go to the active node, failing over to the others
+	nodes []*fullNode
+
+	// nodeLock guards active and recentPeaks
+	nodeLock *sync.Mutex
+	active   int
+
+	// recentPeaks are the header hashes of the most recent peaks, so a peak announced by several nodes is only
+	// processed once
+	recentPeaks []types.Bytes32
+
+	// nodeDB, when set, is a copy of a full node's blockchain database that blocks are read from instead of the RPC
+	nodeDB *nodeDB
+
+	// nodeConsensusCheck compares the header hash of every new peak across the nodes
+	nodeConsensusCheck bool
+
+	// countCoins counts the coins created and spent by the blocks saved in batches too, not only new peaks
+	countCoins bool
+
+	server *http.Server
+
+	store BlockStore
 
 	// This holds a custom prometheus registry so that only our metrics are exported, and not the default go metrics
 	registry          *prometheus.Registry
 	prometheusMetrics *prometheusMetrics
 
-	lookbackWindow uint32
-	rpcPerPage     uint32
+	rpcPerPage uint32
+
+	// settings are the options that can be reloaded while running. Use config() to read them
+	settings atomic.Pointer[settings]
+
+	// entities groups addresses by the operator that farms to them, for the entity aware NC
+	entities *EntityRegistry
+
+	// labels are the human readable labels for addresses, reloaded when the labels-file changes
+	labels *LabelRegistry
 
 	refreshing  *sync.Mutex
 	peakLock    *sync.Mutex
 	highestPeak uint32
 
 	fillGapsLock *sync.Mutex
+
+	// stopLock guards stopping, so no new work is added to inFlight once Shutdown starts waiting for it
+	stopLock *sync.Mutex
+	stopping bool
+	inFlight *sync.WaitGroup
+
+	workCtx    context.Context
+	cancelWork context.CancelFunc
 }
 
 // NewMetrics returns a new metrics instance
-func NewMetrics(exporterPort uint16, dbHost string, dbPort uint16, dbUser string, dbPass string, dbName string, lookbackWindow int, rpcPerPage int) (*Metrics, error) {
+func NewMetrics(ctx context.Context, exporterPort uint16, dbHost string, dbPort uint16, dbUser string, dbPass string, dbName string, lookbackWindow int, rpcPerPage int) (*Metrics, error) {
 	var err error
 
 	metrics := &Metrics{
-		exporterPort:      exporterPort,
-		dbHost:            dbHost,
-		dbPort:            dbPort,
-		dbUser:            dbUser,
-		dbPass:            dbPass,
-		dbName:            dbName,
-		registry:          prometheus.NewRegistry(),
-		prometheusMetrics: &prometheusMetrics{},
-		lookbackWindow:    uint32(lookbackWindow),
-		rpcPerPage:        uint32(rpcPerPage),
-		refreshing:        &sync.Mutex{},
-		peakLock:          &sync.Mutex{},
-		fillGapsLock:      &sync.Mutex{},
-	}
-
-	metrics.websocketClient, err = rpc.NewClient(rpc.ConnectionModeWebsocket, rpc.WithAutoConfig(), rpc.WithSyncWebsocket(), rpc.WithBaseURL(&url.URL{
-		Scheme: "wss",
-		Host:   viper.GetString("chia-hostname"),
-	}))
+		exporterPort:       exporterPort,
+		dbDriver:           viper.GetString("db-driver"),
+		dbHost:             dbHost,
+		dbPort:             dbPort,
+		dbUser:             dbUser,
+		dbPass:             dbPass,
+		dbName:             dbName,
+		registry:           prometheus.NewRegistry(),
+		prometheusMetrics:  &prometheusMetrics{},
+		rpcPerPage:         uint32(rpcPerPage),
+		nodeLock:           &sync.Mutex{},
+		nodeConsensusCheck: viper.GetBool("node-consensus-check"),
+		countCoins:         viper.GetBool("count-coins"),
+		refreshing:         &sync.Mutex{},
+		peakLock:           &sync.Mutex{},
+		fillGapsLock:       &sync.Mutex{},
+		stopLock:           &sync.Mutex{},
+		inFlight:           &sync.WaitGroup{},
+	}
+
+	// Work started by websocket events isn't tied to a request, so it runs until Shutdown cancels it
+	metrics.workCtx, metrics.cancelWork = context.WithCancel(context.Background())
+
+	initialSettings, err := loadSettings(lookbackWindow, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	metrics.entities, err = loadEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.labels, err = loadLabels()
+	if err != nil {
+		return nil, err
+	}
+
+	configured, err := networkConfigs()
+	if err != nil {
+		return nil, err
+	}
+	err = metrics.initNetwork(configured[0])
+	if err != nil {
+		return nil, err
+	}
+	metrics.networks = []*Metrics{metrics}
+
 	err = metrics.createDBClient()
 	if err != nil {
 		return nil, err
 	}
 
-	err = metrics.initTables()
+	err = metrics.prepareSchema(ctx, viper.GetBool("auto-migrate"), viper.GetBool("allow-pending-migrations"))
 	if err != nil {
 		return nil, err
 	}
 
 	metrics.initMetrics()
+	metrics.applySettings(initialSettings)
+	metrics.setActiveNode(metrics.nodes[0])
 
 	return metrics, nil
 }
 
 func (m *Metrics) createDBClient() error {
-	var err error
-
-	cfg := mysql.Config{
-		User:                 m.dbUser,
-		Passwd:               m.dbPass,
-		Net:                  "tcp",
-		Addr:                 fmt.Sprintf("%s:%d", m.dbHost, m.dbPort),
-		DBName:               m.dbName,
-		AllowNativePasswords: true,
-	}
-	m.mysqlClient, err = sql.Open("mysql", cfg.FormatDSN())
+	store, err := newBlockStore(m.dbDriver, m.dbHost, m.dbPort, m.dbUser, m.dbPass, m.dbName)
 	if err != nil {
 		return err
 	}
-
-	m.mysqlClient.SetConnMaxLifetime(time.Minute * 3)
-	m.mysqlClient.SetMaxOpenConns(10)
-	m.mysqlClient.SetMaxIdleConns(10)
+	m.store = store.ForNetwork(m.network.Name)
 
 	return nil
 }
@@ -124,7 +225,43 @@ func (m *Metrics) initMetrics() {
 	m.prometheusMetrics.nakamotoCoefficient51 = m.newGauge("nakamoto_coefficient_gt51", "Nakamoto coefficient when we calculate for >51% of nodes")
 	m.prometheusMetrics.nakamotoCoefficient50Adjusted = m.newGauge("nakamoto_coefficient_gt50_adjusted", "Nakamoto coefficient when we calculate for >50% of nodes excluding configured farmer addresses")
 	m.prometheusMetrics.nakamotoCoefficient51Adjusted = m.newGauge("nakamoto_coefficient_gt51_adjusted", "Nakamoto coefficient when we calculate for >51% of nodes excluding configured farmer addresses")
+	m.prometheusMetrics.nakamotoCoefficient = m.newGaugeVec("nakamoto_coefficient", "Nakamoto coefficient for each configured threshold and lookback window", []string{"threshold", "window"})
+	m.prometheusMetrics.nakamotoCoefficientAdjusted = m.newGaugeVec("nakamoto_coefficient_adjusted", "Nakamoto coefficient for each configured threshold and lookback window excluding configured farmer addresses", []string{"threshold", "window"})
+	m.prometheusMetrics.gini = m.newGauge("gini_coefficient", "Gini coefficient of the blocks won by each farmer in the lookback window")
+	m.prometheusMetrics.hhi = m.newGauge("herfindahl_hirschman_index", "Herfindahl-Hirschman Index of the share of blocks won by each farmer in the lookback window")
+	m.prometheusMetrics.shannon = m.newGauge("shannon_entropy", "Shannon entropy of the share of blocks won by each farmer in the lookback window")
+	m.prometheusMetrics.effectiveFarmers = m.newGauge("effective_farmers", "Number of equally sized farmers with the same Shannon entropy as the lookback window")
+	m.prometheusMetrics.theil = m.newGauge("theil_index", "Theil index of the blocks won by each farmer in the lookback window")
+	m.prometheusMetrics.giniAdjusted = m.newGauge("gini_coefficient_adjusted", "Gini coefficient of the blocks won by each farmer in the lookback window excluding configured farmer addresses")
+	m.prometheusMetrics.hhiAdjusted = m.newGauge("herfindahl_hirschman_index_adjusted", "Herfindahl-Hirschman Index of the share of blocks won by each farmer in the lookback window excluding configured farmer addresses")
+	m.prometheusMetrics.shannonAdjusted = m.newGauge("shannon_entropy_adjusted", "Shannon entropy of the share of blocks won by each farmer in the lookback window excluding configured farmer addresses")
+	m.prometheusMetrics.effectiveFarmersAdjusted = m.newGauge("effective_farmers_adjusted", "Number of equally sized farmers with the same Shannon entropy as the lookback window excluding configured farmer addresses")
+	m.prometheusMetrics.theilAdjusted = m.newGauge("theil_index_adjusted", "Theil index of the blocks won by each farmer in the lookback window excluding configured farmer addresses")
 	m.prometheusMetrics.blockHeight = m.newGauge("block_height", "Block height for current set of metrics")
+	m.prometheusMetrics.reorgCount = m.newCounter("reorgs_total", "Number of chain reorganizations that required rolling back blocks in the database")
+	m.prometheusMetrics.reorgDepth = m.newGauge("last_reorg_depth", "Number of blocks rolled back in the most recent chain reorganization")
+	m.prometheusMetrics.topFarmerBlocks = m.newGaugeVec("top_farmer_blocks", "Number of blocks won in the lookback window by the top farmer addresses", []string{"farmer_address"})
+	m.prometheusMetrics.topFarmerPercent = m.newGaugeVec("top_farmer_percent", "Percentage of blocks won in the lookback window by the top farmer addresses", []string{"farmer_address"})
+	m.prometheusMetrics.topFarmerRank = m.newGaugeVec("top_farmer_rank", "Rank of the top farmer addresses by blocks won in the lookback window", []string{"farmer_address"})
+	m.prometheusMetrics.topFarmerInfo = m.newGaugeVec("top_farmer_info", "Label and category of the labelled top farmer addresses. Always 1", []string{"farmer_address", "label", "category"})
+	m.prometheusMetrics.feesPerBlock = m.newGaugeVec("fees_per_block", "Average fees in mojos per transaction block in the window", []string{"window"})
+	m.prometheusMetrics.blockFullness = m.newGaugeVec("block_fullness", "Average cost of the transaction blocks in the window as a fraction of the max block cost", []string{"window"})
+	m.prometheusMetrics.transactionsPerSecond = m.newGaugeVec("transactions_per_second", "Coins spent per second in the window", []string{"window"})
+	m.prometheusMetrics.poolNakamotoCoefficient = m.newGaugeVec("pool_nakamoto_coefficient", "Nakamoto coefficient for each configured threshold with blocks grouped by pool address", []string{"threshold"})
+	m.prometheusMetrics.topPoolsPercent = m.newGauge("top_pools_percent", "Percentage of the lookback window won by the top pool addresses")
+	m.prometheusMetrics.poolHHI = m.newGauge("pool_herfindahl_hirschman_index", "Herfindahl-Hirschman Index of the share of blocks won by each pool address in the lookback window")
+	m.prometheusMetrics.plotTypePercent = m.newGaugeVec("plot_type_percent", "Percentage of the blocks in the lookback window won by pooled and solo plots", []string{"type"})
+	m.prometheusMetrics.entityNakamotoCoefficient = m.newGaugeVec("entity_nakamoto_coefficient", "Nakamoto coefficient for each configured threshold with addresses grouped by entity", []string{"threshold"})
+	m.prometheusMetrics.configReloads = m.newCounterVec("config_reload_total", "Number of times the config file was reloaded, by result", []string{"result"})
+	m.prometheusMetrics.configReloads.WithLabelValues("success")
+	m.prometheusMetrics.configReloads.WithLabelValues("failure")
+	m.prometheusMetrics.configInfo = m.newGaugeVec("config_info", "Hash of the settings currently in use. Always 1", []string{"hash"})
+	m.prometheusMetrics.activeNode = m.newGaugeVec("active_node", "1 for the full node requests are sent to, 0 for the others", []string{"hostname"})
+	m.prometheusMetrics.nodeHealthy = m.newGaugeVec("node_healthy", "1 if the full node is connected and its last request succeeded, 0 otherwise", []string{"hostname"})
+	m.prometheusMetrics.nodePeakHeight = m.newGaugeVec("node_peak_height", "Height of the last new peak the full node announced", []string{"hostname"})
+	m.prometheusMetrics.nodeRequestFailures = m.newCounterVec("node_request_failures_total", "Number of requests to the full node that failed", []string{"hostname"})
+	m.prometheusMetrics.nodeConsensusMismatches = m.newCounterVec("node_consensus_mismatches_total", "Number of new peaks the full node had a different header hash for", []string{"hostname"})
+	m.prometheusMetrics.entityNakamotoCoefficientAdjusted = m.newGaugeVec("entity_nakamoto_coefficient_adjusted", "Nakamoto coefficient for each configured threshold with addresses grouped by entity excluding configured farmer addresses", []string{"threshold"})
 }
 
 // newGauge returns a lazy gauge that follows naming conventions
@@ -134,6 +271,8 @@ func (m *Metrics) newGauge(name string, help string) *wrappedPrometheus.LazyGaug
 		Subsystem: "block_metrics",
 		Name:      name,
 		Help:      help,
+		// Several networks can share the registry, so every metric is labelled with its network
+		ConstLabels: prometheus.Labels{"network": m.network.Name},
 	}
 
 	gm := prometheus.NewGauge(opts)
@@ -146,7 +285,107 @@ func (m *Metrics) newGauge(name string, help string) *wrappedPrometheus.LazyGaug
 	return lg
 }
 
+// newCounter returns a counter that follows naming conventions
+// Counters are registered right away, since zero is a meaningful value for them
+func (m *Metrics) newCounter(name string, help string) prometheus.Counter {
+	opts := prometheus.CounterOpts{
+		Namespace:   "chia",
+		Subsystem:   "block_metrics",
+		Name:        name,
+		Help:        help,
+		ConstLabels: prometheus.Labels{"network": m.network.Name},
+	}
+
+	cm := prometheus.NewCounter(opts)
+	m.registry.MustRegister(cm)
+
+	return cm
+}
+
+// newCounterVec returns a counter vector that follows naming conventions
+func (m *Metrics) newCounterVec(name string, help string, labels []string) *prometheus.CounterVec {
+	opts := prometheus.CounterOpts{
+		Namespace:   "chia",
+		Subsystem:   "block_metrics",
+		Name:        name,
+		Help:        help,
+		ConstLabels: prometheus.Labels{"network": m.network.Name},
+	}
+
+	cv := prometheus.NewCounterVec(opts, labels)
+	m.registry.MustRegister(cv)
+
+	return cv
+}
+
+// newGaugeVec returns a gauge vector that follows naming conventions
+// Vectors are registered right away, since they aren't exported until a labelled gauge is set
+func (m *Metrics) newGaugeVec(name string, help string, labels []string) *prometheus.GaugeVec {
+	opts := prometheus.GaugeOpts{
+		Namespace:   "chia",
+		Subsystem:   "block_metrics",
+		Name:        name,
+		Help:        help,
+		ConstLabels: prometheus.Labels{"network": m.network.Name},
+	}
+
+	gv := prometheus.NewGaugeVec(opts, labels)
+	m.registry.MustRegister(gv)
+
+	return gv
+}
+
 // LookbackWindow returns the configured lookback window
 func (m *Metrics) LookbackWindow() uint32 {
-	return m.lookbackWindow
+	return m.config().lookbackWindow
+}
+
+// LookbackWindows returns every lookback window the NC is calculated for, starting with the LookbackWindow
+func (m *Metrics) LookbackWindows() []uint32 {
+	return m.config().lookbackWindows
+}
+
+// NakamotoThresholds returns the configured NC threshold percentages
+func (m *Metrics) NakamotoThresholds() []int {
+	return m.config().nakamotoThresholds
+}
+
+// nakamotoThresholds validates the configured threshold percentages and removes duplicates
+func nakamotoThresholds(configured []int) ([]int, error) {
+	var thresholds []int
+	seen := map[int]bool{}
+	for _, threshold := range configured {
+		if threshold <= 0 || threshold > 100 {
+			return nil, fmt.Errorf("invalid nakamoto threshold %d. Must be between 1 and 100", threshold)
+		}
+		if seen[threshold] {
+			continue
+		}
+		seen[threshold] = true
+		thresholds = append(thresholds, threshold)
+	}
+
+	return thresholds, nil
+}
+
+// lookbackWindows returns the primary lookback window followed by any additional configured windows, without duplicates
+func lookbackWindows(primary uint32, additional []int) ([]uint32, error) {
+	if primary == 0 {
+		return nil, fmt.Errorf("lookback-window must be greater than 0")
+	}
+
+	windows := []uint32{primary}
+	seen := map[uint32]bool{primary: true}
+	for _, window := range additional {
+		if window <= 0 {
+			return nil, fmt.Errorf("invalid lookback window %d. Must be greater than 0", window)
+		}
+		if seen[uint32(window)] {
+			continue
+		}
+		seen[uint32(window)] = true
+		windows = append(windows, uint32(window))
+	}
+
+	return windows, nil
 }
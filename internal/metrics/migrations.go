@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// statementBreak matches the line that separates the statements in a migration file with more than one statement
+var statementBreak = regexp.MustCompile(`(?m)^-- statement-break[ \t]*$`)
+
+// migration is a single versioned change to the database schema
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations returns the embedded migrations for the dialect, sorted by version
+// Migration files are stored in migrations/<dialect> and named <version>_<name>.<up|down>.sql
+func loadMigrations(dialectName string) ([]migration, error) {
+	dir := path.Join("migrations", dialectName)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+
+		versionStr, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name %s", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in migration file name %s: %w", fileName, err)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: name}
+			byVersion[version] = mig
+		}
+
+		switch direction {
+		case ".up":
+			mig.up = string(content)
+		case ".down":
+			mig.down = string(content)
+		default:
+			return nil, fmt.Errorf("migration file %s must end in .up.sql or .down.sql", fileName)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, fmt.Errorf("no migrations found for %s", dialectName)
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d is missing an up migration", mig.version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// initMigrationsTable ensures the table that tracks the applied migrations exists
+func (s *sqlStore) initMigrationsTable(ctx context.Context) error {
+	return s.exec(ctx, s.dialect.migrationsTable)
+}
+
+// appliedMigrations returns the time each applied migration was applied at, keyed by version
+func (s *sqlStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	err := s.initMigrationsTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// CheckSchemaVersion returns an error if the schema is newer than the latest migration this binary knows about
+func (s *sqlStore) CheckSchemaVersion(ctx context.Context) error {
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database schema version %d is newer than the latest version this binary supports (%d)", version, latest)
+		}
+	}
+
+	return nil
+}
+
+// MigrateUp applies all pending migrations, in order
+func (s *sqlStore) MigrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		if _, ok := applied[mig.version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d %s\n", mig.version, mig.name)
+		err = s.execMigration(ctx, mig.up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES(?, ?, ?)", mig.version, mig.name, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("error applying migration %d %s: %w", mig.version, mig.name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migrations
+func (s *sqlStore) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		mig := migrations[i]
+		if _, ok := applied[mig.version]; !ok {
+			continue
+		}
+		if mig.down == "" {
+			return fmt.Errorf("migration %d %s can not be rolled back", mig.version, mig.name)
+		}
+
+		log.Printf("Rolling back migration %d %s\n", mig.version, mig.name)
+		err = s.execMigration(ctx, mig.down, "DELETE FROM schema_migrations WHERE version = ?", mig.version)
+		if err != nil {
+			return fmt.Errorf("error rolling back migration %d %s: %w", mig.version, mig.name, err)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// MigrationStatus returns every known migration and whether it has been applied
+func (s *sqlStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, mig := range migrations {
+		appliedAt, ok := applied[mig.version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   mig.version,
+			Name:      mig.name,
+			Applied:   ok,
+			AppliedAt: sql.NullTime{Time: appliedAt, Valid: ok},
+		})
+	}
+
+	return statuses, nil
+}
+
+// execMigration runs each statement in the migration, followed by the statement that records it in the
+// schema_migrations table
+// On PostgreSQL and SQLite, the migration and the record are in a single transaction, so a failure part way through
+// leaves neither applied. MySQL commits DDL statements implicitly, so a transaction wouldn't help, and a failure part
+// way through a migration has to be fixed by hand before the migration is run again
+func (s *sqlStore) execMigration(ctx context.Context, content string, record string, args ...interface{}) error {
+	statements := migrationStatements(content)
+	if !s.dialect.transactionalDDL {
+		for _, statement := range statements {
+			_, err := s.db.ExecContext(ctx, statement)
+			if err != nil {
+				return err
+			}
+		}
+		return s.exec(ctx, record, args...)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, s.rebind(record), args...)
+	}
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			log.Errorf("Could not roll back migration: %s\n", rollbackErr.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrationStatements splits the migration into statements at the lines that are only a statementBreak comment, so
+// statements can contain semicolons in string literals or trigger bodies
+func migrationStatements(content string) []string {
+	var statements []string
+	for _, statement := range statementBreak.Split(content, -1) {
+		statement = strings.TrimSpace(statement)
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `blocks` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `timestamp` DATETIME DEFAULT NULL,
+  `height` int DEFAULT NULL,
+  `transaction_block` tinyint(1) NOT NULL,
+  `farmer_puzzle_hash` varchar(255) DEFAULT NULL,
+  `farmer_address` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `height-unique` (`height`),
+  KEY `height` (`height`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,3 @@
+ALTER TABLE `blocks`
+  DROP COLUMN `header_hash`,
+  DROP COLUMN `prev_header_hash`;
@@ -0,0 +1,3 @@
+ALTER TABLE `blocks`
+  ADD COLUMN `header_hash` varchar(255) DEFAULT NULL,
+  ADD COLUMN `prev_header_hash` varchar(255) DEFAULT NULL;
@@ -0,0 +1 @@
+ALTER TABLE `blocks` ADD KEY `timestamp` (`timestamp`);
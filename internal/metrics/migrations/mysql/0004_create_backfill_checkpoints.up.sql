@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `backfill_checkpoints` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `start_height` int NOT NULL,
+  `end_height` int NOT NULL,
+  `completed_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
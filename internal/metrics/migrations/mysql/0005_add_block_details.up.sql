@@ -0,0 +1,9 @@
+ALTER TABLE `blocks`
+  ADD COLUMN `weight` DECIMAL(39,0) DEFAULT NULL,
+  ADD COLUMN `total_iters` DECIMAL(39,0) DEFAULT NULL,
+  ADD COLUMN `signage_point_index` tinyint unsigned DEFAULT NULL,
+  ADD COLUMN `pool_target_puzzle_hash` varchar(255) DEFAULT NULL,
+  ADD COLUMN `pool_public_key` varchar(255) DEFAULT NULL,
+  ADD COLUMN `pool_contract_puzzle_hash` varchar(255) DEFAULT NULL,
+  ADD COLUMN `plot_public_key` varchar(255) DEFAULT NULL,
+  ADD COLUMN `k_size` tinyint unsigned DEFAULT NULL;
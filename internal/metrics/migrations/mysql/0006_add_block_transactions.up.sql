@@ -0,0 +1,7 @@
+ALTER TABLE `blocks`
+  ADD COLUMN `fees` bigint unsigned DEFAULT NULL,
+  ADD COLUMN `cost` bigint unsigned DEFAULT NULL,
+  ADD COLUMN `additions` int unsigned DEFAULT NULL,
+  ADD COLUMN `removals` int unsigned DEFAULT NULL,
+  ADD COLUMN `reward_claims` int unsigned DEFAULT NULL,
+  ADD COLUMN `reward_claims_amount` bigint unsigned DEFAULT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE `blocks`
+  DROP COLUMN `pool_address`;
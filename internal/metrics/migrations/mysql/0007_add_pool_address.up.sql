@@ -0,0 +1,2 @@
+ALTER TABLE `blocks`
+  ADD COLUMN `pool_address` varchar(255) DEFAULT NULL;
@@ -0,0 +1,11 @@
+DELETE FROM `blocks` WHERE `network` <> 'mainnet';
+-- statement-break
+DELETE FROM `backfill_checkpoints` WHERE `network` <> 'mainnet';
+-- statement-break
+ALTER TABLE `blocks`
+  DROP INDEX `network-height-unique`,
+  ADD UNIQUE KEY `height-unique` (`height`),
+  DROP COLUMN `network`;
+-- statement-break
+ALTER TABLE `backfill_checkpoints`
+  DROP COLUMN `network`;
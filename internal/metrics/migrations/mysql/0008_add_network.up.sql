@@ -0,0 +1,7 @@
+ALTER TABLE `blocks`
+  ADD COLUMN `network` varchar(255) DEFAULT NULL,
+  DROP INDEX `height-unique`,
+  ADD UNIQUE KEY `network-height-unique` (`network`, `height`);
+-- statement-break
+ALTER TABLE `backfill_checkpoints`
+  ADD COLUMN `network` varchar(255) DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE `blocks`
+  ADD KEY `timestamp` (`timestamp`),
+  DROP KEY `network-timestamp-height`;
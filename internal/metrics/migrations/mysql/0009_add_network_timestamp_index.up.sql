@@ -0,0 +1,3 @@
+ALTER TABLE `blocks`
+  ADD KEY `network-timestamp-height` (`network`, `timestamp`, `height`),
+  DROP KEY `timestamp`;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  id serial PRIMARY KEY,
+  timestamp timestamp DEFAULT NULL,
+  height integer DEFAULT NULL,
+  transaction_block boolean NOT NULL,
+  farmer_puzzle_hash varchar(255) DEFAULT NULL,
+  farmer_address varchar(255) DEFAULT NULL,
+  CONSTRAINT "height-unique" UNIQUE (height)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+  id serial PRIMARY KEY,
+  start_height integer NOT NULL,
+  end_height integer NOT NULL,
+  completed_at timestamp NOT NULL
+);
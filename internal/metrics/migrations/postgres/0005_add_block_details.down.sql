@@ -0,0 +1,9 @@
+ALTER TABLE blocks
+  DROP COLUMN weight,
+  DROP COLUMN total_iters,
+  DROP COLUMN signage_point_index,
+  DROP COLUMN pool_target_puzzle_hash,
+  DROP COLUMN pool_public_key,
+  DROP COLUMN pool_contract_puzzle_hash,
+  DROP COLUMN plot_public_key,
+  DROP COLUMN k_size;
@@ -0,0 +1,7 @@
+ALTER TABLE blocks
+  DROP COLUMN fees,
+  DROP COLUMN cost,
+  DROP COLUMN additions,
+  DROP COLUMN removals,
+  DROP COLUMN reward_claims,
+  DROP COLUMN reward_claims_amount;
@@ -0,0 +1,7 @@
+ALTER TABLE blocks
+  ADD COLUMN fees bigint DEFAULT NULL,
+  ADD COLUMN cost bigint DEFAULT NULL,
+  ADD COLUMN additions integer DEFAULT NULL,
+  ADD COLUMN removals integer DEFAULT NULL,
+  ADD COLUMN reward_claims integer DEFAULT NULL,
+  ADD COLUMN reward_claims_amount bigint DEFAULT NULL;
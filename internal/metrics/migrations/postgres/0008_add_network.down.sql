@@ -0,0 +1,11 @@
+DELETE FROM blocks WHERE network <> 'mainnet';
+-- statement-break
+DELETE FROM backfill_checkpoints WHERE network <> 'mainnet';
+-- statement-break
+ALTER TABLE blocks
+  DROP CONSTRAINT "network-height-unique",
+  ADD CONSTRAINT "height-unique" UNIQUE (height),
+  DROP COLUMN network;
+-- statement-break
+ALTER TABLE backfill_checkpoints
+  DROP COLUMN network;
@@ -0,0 +1,7 @@
+ALTER TABLE blocks
+  ADD COLUMN network varchar(255) DEFAULT NULL,
+  DROP CONSTRAINT "height-unique",
+  ADD CONSTRAINT "network-height-unique" UNIQUE (network, height);
+-- statement-break
+ALTER TABLE backfill_checkpoints
+  ADD COLUMN network varchar(255) DEFAULT NULL;
@@ -0,0 +1,3 @@
+CREATE INDEX blocks_timestamp ON blocks (timestamp);
+-- statement-break
+DROP INDEX blocks_network_timestamp_height;
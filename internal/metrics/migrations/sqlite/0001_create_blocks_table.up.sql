@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  timestamp DATETIME DEFAULT NULL,
+  height INTEGER DEFAULT NULL UNIQUE,
+  transaction_block BOOLEAN NOT NULL,
+  farmer_puzzle_hash TEXT DEFAULT NULL,
+  farmer_address TEXT DEFAULT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE blocks DROP COLUMN header_hash;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN prev_header_hash;
@@ -0,0 +1,3 @@
+ALTER TABLE blocks ADD COLUMN header_hash TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN prev_header_hash TEXT DEFAULT NULL;
@@ -0,0 +1 @@
+DROP INDEX blocks_timestamp;
@@ -0,0 +1 @@
+CREATE INDEX blocks_timestamp ON blocks (timestamp);
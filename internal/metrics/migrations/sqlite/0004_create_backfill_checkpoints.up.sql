@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  start_height INTEGER NOT NULL,
+  end_height INTEGER NOT NULL,
+  completed_at DATETIME NOT NULL
+);
@@ -0,0 +1,15 @@
+ALTER TABLE blocks DROP COLUMN weight;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN total_iters;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN signage_point_index;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN pool_target_puzzle_hash;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN pool_public_key;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN pool_contract_puzzle_hash;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN plot_public_key;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN k_size;
@@ -0,0 +1,15 @@
+ALTER TABLE blocks ADD COLUMN weight TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN total_iters TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN signage_point_index INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN pool_target_puzzle_hash TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN pool_public_key TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN pool_contract_puzzle_hash TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN plot_public_key TEXT DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN k_size INTEGER DEFAULT NULL;
@@ -0,0 +1,11 @@
+ALTER TABLE blocks DROP COLUMN fees;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN cost;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN additions;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN removals;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN reward_claims;
+-- statement-break
+ALTER TABLE blocks DROP COLUMN reward_claims_amount;
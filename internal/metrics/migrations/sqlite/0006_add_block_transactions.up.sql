@@ -0,0 +1,11 @@
+ALTER TABLE blocks ADD COLUMN fees INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN cost INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN additions INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN removals INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN reward_claims INTEGER DEFAULT NULL;
+-- statement-break
+ALTER TABLE blocks ADD COLUMN reward_claims_amount INTEGER DEFAULT NULL;
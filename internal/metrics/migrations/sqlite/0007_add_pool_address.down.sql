@@ -0,0 +1 @@
+ALTER TABLE blocks DROP COLUMN pool_address;
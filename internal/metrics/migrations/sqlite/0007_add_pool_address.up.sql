@@ -0,0 +1 @@
+ALTER TABLE blocks ADD COLUMN pool_address TEXT DEFAULT NULL;
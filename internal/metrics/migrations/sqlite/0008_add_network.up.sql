@@ -0,0 +1,37 @@
+CREATE TABLE blocks_rebuild (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  timestamp DATETIME DEFAULT NULL,
+  height INTEGER DEFAULT NULL,
+  transaction_block BOOLEAN NOT NULL,
+  farmer_puzzle_hash TEXT DEFAULT NULL,
+  farmer_address TEXT DEFAULT NULL,
+  header_hash TEXT DEFAULT NULL,
+  prev_header_hash TEXT DEFAULT NULL,
+  weight TEXT DEFAULT NULL,
+  total_iters TEXT DEFAULT NULL,
+  signage_point_index INTEGER DEFAULT NULL,
+  pool_target_puzzle_hash TEXT DEFAULT NULL,
+  pool_public_key TEXT DEFAULT NULL,
+  pool_contract_puzzle_hash TEXT DEFAULT NULL,
+  plot_public_key TEXT DEFAULT NULL,
+  k_size INTEGER DEFAULT NULL,
+  fees INTEGER DEFAULT NULL,
+  cost INTEGER DEFAULT NULL,
+  additions INTEGER DEFAULT NULL,
+  removals INTEGER DEFAULT NULL,
+  reward_claims INTEGER DEFAULT NULL,
+  reward_claims_amount INTEGER DEFAULT NULL,
+  pool_address TEXT DEFAULT NULL,
+  network TEXT DEFAULT NULL,
+  UNIQUE (network, height)
+);
+-- statement-break
+INSERT INTO blocks_rebuild (id, timestamp, height, transaction_block, farmer_puzzle_hash, farmer_address, header_hash, prev_header_hash, weight, total_iters, signage_point_index, pool_target_puzzle_hash, pool_public_key, pool_contract_puzzle_hash, plot_public_key, k_size, fees, cost, additions, removals, reward_claims, reward_claims_amount, pool_address) SELECT id, timestamp, height, transaction_block, farmer_puzzle_hash, farmer_address, header_hash, prev_header_hash, weight, total_iters, signage_point_index, pool_target_puzzle_hash, pool_public_key, pool_contract_puzzle_hash, plot_public_key, k_size, fees, cost, additions, removals, reward_claims, reward_claims_amount, pool_address FROM blocks;
+-- statement-break
+DROP TABLE blocks;
+-- statement-break
+ALTER TABLE blocks_rebuild RENAME TO blocks;
+-- statement-break
+CREATE INDEX blocks_timestamp ON blocks (timestamp);
+-- statement-break
+ALTER TABLE backfill_checkpoints ADD COLUMN network TEXT DEFAULT NULL;
@@ -0,0 +1,3 @@
+CREATE INDEX blocks_network_timestamp_height ON blocks (network, timestamp, height);
+-- statement-break
+DROP INDEX blocks_timestamp;
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CalculateNakamoto calculates the NC for the given peak height and percentage
+func (m *Metrics) CalculateNakamoto(ctx context.Context, peakHeight uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	return m.CalculateNakamotoForWindow(ctx, peakHeight, m.LookbackWindow(), thresholdPercent, ignoreAddresses)
+}
+
+// CalculateNakamotoForWindow calculates the NC for the given peak height, lookback window, and percentage
+func (m *Metrics) CalculateNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	distribution, err := m.GetFarmerDistribution(ctx, peakHeight, lookbackWindow, ignoreAddresses)
+	if err != nil {
+		return 0, err
+	}
+
+	return nakamotoCoefficient(distribution, lookbackWindow, thresholdPercent)
+}
+
+// GetFarmerDistribution returns the number of blocks each farmer address won in the lookback window ending at the
+// peak height, excluding ignoreAddresses, sorted by number of blocks descending
+func (m *Metrics) GetFarmerDistribution(ctx context.Context, peakHeight uint32, lookbackWindow uint32, ignoreAddresses []string) ([]FarmerBlocks, error) {
+	if peakHeight < lookbackWindow {
+		return nil, notEnoughBlocksError{lookbackWindow: lookbackWindow}
+	}
+	minHeight := peakHeight - lookbackWindow
+
+	// First, make sure we actually have enough blocks in the lookback window to do accurate math
+	// Otherwise, just return an error (assume we are still syncing block history over)
+	count, err := m.store.CountBlocks(ctx, minHeight, peakHeight)
+	if err != nil {
+		return nil, err
+	}
+	if count < lookbackWindow {
+		return nil, notEnoughBlocksError{lookbackWindow: lookbackWindow}
+	}
+
+	return m.store.GetFarmerDistribution(ctx, minHeight, peakHeight, ignoreAddresses)
+}
+
+// refreshWindowNakamoto advances the in memory lookback window to peakHeight and sets the NC gauges for every
+// configured threshold. A window that doesn't have enough blocks yet is skipped without affecting the other windows
+func (m *Metrics) refreshWindowNakamoto(ctx context.Context, settings *settings, peakHeight uint32, window uint32) {
+	engine := settings.engines[window]
+	err := engine.advance(ctx, m.store, peakHeight)
+	if err != nil {
+		log.Errorf("Error updating the %d block lookback window: %s\n", window, err.Error())
+		return
+	}
+
+	windowLabel := strconv.FormatUint(uint64(window), 10)
+	for _, threshold := range settings.nakamotoThresholds {
+		thresholdLabel := strconv.Itoa(threshold)
+
+		nakamoto, err := m.engineNakamoto(ctx, settings, engine, peakHeight, threshold, []string{})
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold nakamoto coefficient for the %d block lookback window: %s\n", threshold, window, err.Error())
+			return
+		}
+
+		nakamotoAdj, err := m.engineNakamoto(ctx, settings, engine, peakHeight, threshold, m.adjustedIgnoreAddresses(settings))
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold adjusted nakamoto coefficient for the %d block lookback window: %s\n", threshold, window, err.Error())
+			return
+		}
+
+		m.prometheusMetrics.nakamotoCoefficient.WithLabelValues(thresholdLabel, windowLabel).Set(float64(nakamoto))
+		m.prometheusMetrics.nakamotoCoefficientAdjusted.WithLabelValues(thresholdLabel, windowLabel).Set(float64(nakamotoAdj))
+
+		if window == settings.lookbackWindow {
+			m.setFixedThresholdNakamoto(threshold, nakamoto, nakamotoAdj)
+		}
+	}
+}
+
+// setFixedThresholdNakamoto sets the original 50% and 51% NC gauges, which are kept for existing dashboards
+func (m *Metrics) setFixedThresholdNakamoto(thresholdPercent int, nakamoto int, nakamotoAdj int) {
+	switch thresholdPercent {
+	case 50:
+		m.prometheusMetrics.nakamotoCoefficient50.Set(float64(nakamoto))
+		m.prometheusMetrics.nakamotoCoefficient50Adjusted.Set(float64(nakamotoAdj))
+	case 51:
+		m.prometheusMetrics.nakamotoCoefficient51.Set(float64(nakamoto))
+		m.prometheusMetrics.nakamotoCoefficient51Adjusted.Set(float64(nakamotoAdj))
+	}
+}
+
+// engineNakamoto calculates the NC from the in memory lookback window, which must already be advanced to peakHeight
+// If nakamoto-cross-check is enabled, the result is compared against the SQL calculation and any mismatch is logged
+func (m *Metrics) engineNakamoto(ctx context.Context, settings *settings, engine *nakamotoEngine, peakHeight uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	distribution, err := engine.distribution(ignoreAddresses)
+	if err != nil {
+		return 0, err
+	}
+
+	nakamoto, err := nakamotoCoefficient(distribution, engine.windowSize, thresholdPercent)
+	if err != nil {
+		return 0, err
+	}
+
+	if settings.crossCheck {
+		sqlNakamoto, err := m.CalculateNakamotoForWindow(ctx, peakHeight, engine.windowSize, thresholdPercent, ignoreAddresses)
+		if err != nil {
+			log.Errorf("Error cross checking %d%% threshold nakamoto coefficient at height %d: %s\n", thresholdPercent, peakHeight, err.Error())
+		} else if sqlNakamoto != nakamoto {
+			log.Warnf("Nakamoto coefficient mismatch for %d%% threshold at height %d. In memory: %d SQL: %d\n", thresholdPercent, peakHeight, nakamoto, sqlNakamoto)
+		}
+	}
+
+	return nakamoto, nil
+}
+
+// WarmUpEngine loads the lookback windows ending at the newest block in the DB into memory
+func (m *Metrics) WarmUpEngine(ctx context.Context) error {
+	newest, err := m.GetNewestBlock(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.refreshing.Lock()
+	defer m.refreshing.Unlock()
+
+	settings := m.config()
+	for _, window := range settings.lookbackWindows {
+		err = settings.engines[window].advance(ctx, m.store, newest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notEnoughBlocksError is returned when the DB doesn't have every block in the lookback window
+// For time based windows, since is the start of the window instead
+type notEnoughBlocksError struct {
+	lookbackWindow uint32
+	since          time.Time
+}
+
+func (e notEnoughBlocksError) Error() string {
+	if !e.since.IsZero() {
+		return fmt.Sprintf("do not have blocks from before %s in database to use for nakamoto coefficient calculation", e.since.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("do not have %d blocks in database to use for nakamoto coefficient calculation", e.lookbackWindow)
+}
+
+// nakamotoCoefficient returns the number of farmers that together won at least thresholdPercent of the totalBlocks
+// The distribution must be sorted by blocks won, descending
+// Ignored addresses are left out of the distribution, but still count towards the total, so the adjusted figures
+// answer how many of the remaining farmers it takes to reach the threshold of all blocks
+func nakamotoCoefficient(distribution []FarmerBlocks, totalBlocks uint32, thresholdPercent int) (int, error) {
+	totalPercent := float64(totalBlocks) / 100
+
+	var cumulativeBlocks uint32
+	for i, farmer := range distribution {
+		cumulativeBlocks += farmer.Blocks
+		if float64(cumulativeBlocks)/totalPercent >= float64(thresholdPercent) {
+			return i + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("farmers in the lookback window do not reach the %d%% threshold", thresholdPercent)
+}
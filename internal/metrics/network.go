@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chia-network/go-chia-libs/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// Network is the chia network the blocks are from
+type Network struct {
+	Name string
+	// AddressPrefix is the prefix for the network's addresses, such as xch for mainnet or txch for the testnets
+	AddressPrefix string
+}
+
+// NetworkConfig is one of the networks to track, from the networks list in the config file
+type NetworkConfig struct {
+	// ChiaRoot has the chia config and certs for the network's full nodes. Defaults to CHIA_ROOT
+	ChiaRoot      string   `mapstructure:"chia-root"`
+	ChiaHostname  string   `mapstructure:"chia-hostname"`
+	ChiaHostnames []string `mapstructure:"chia-hostnames"`
+}
+
+// networkConfigs returns the configured networks. Without a networks list, there is a single network that uses
+// CHIA_ROOT and the chia-hostname or chia-hostnames
+func networkConfigs() ([]NetworkConfig, error) {
+	if !viper.IsSet("networks") {
+		return []NetworkConfig{{
+			ChiaHostname:  viper.GetString("chia-hostname"),
+			ChiaHostnames: viper.GetStringSlice("chia-hostnames"),
+		}}, nil
+	}
+
+	var configured []NetworkConfig
+	err := viper.UnmarshalKey("networks", &configured)
+	if err != nil {
+		return nil, fmt.Errorf("error reading networks: %w", err)
+	}
+	if len(configured) == 0 {
+		return nil, fmt.Errorf("networks must have at least one network")
+	}
+
+	return configured, nil
+}
+
+// hostnames returns the network's full node hostnames without duplicates, falling back to the chia-hostname
+func (c NetworkConfig) hostnames() []string {
+	if len(c.ChiaHostnames) == 0 {
+		if c.ChiaHostname == "" {
+			return []string{"localhost"}
+		}
+		return []string{c.ChiaHostname}
+	}
+
+	var hostnames []string
+	seen := map[string]bool{}
+	for _, hostname := range c.ChiaHostnames {
+		if seen[hostname] {
+			continue
+		}
+		seen[hostname] = true
+		hostnames = append(hostnames, hostname)
+	}
+
+	return hostnames
+}
+
+// loadChiaConfig loads the chia config from the chia root, or from CHIA_ROOT if the root is empty
+func loadChiaConfig(root string) (*config.ChiaConfig, error) {
+	if root == "" {
+		return config.GetChiaConfig()
+	}
+
+	configPath := filepath.Join(root, "config", "config.yaml")
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("chia config file not found at %s: %w", configPath, err)
+	}
+
+	return config.LoadConfigAtRoot(configPath, root)
+}
+
+// chiaNetwork returns the selected_network from the chia config, with the address prefix from its network_overrides
+func chiaNetwork(cfg *config.ChiaConfig) (Network, error) {
+	selected := cfg.SelectedNetwork
+	if selected == nil || *selected == "" {
+		selected = cfg.FullNode.SelectedNetwork
+	}
+	if selected == nil || *selected == "" {
+		return Network{}, fmt.Errorf("selected_network is not set in the chia config at %s", cfg.ChiaRoot)
+	}
+
+	overrides := cfg.NetworkOverrides
+	if overrides == nil {
+		overrides = cfg.FullNode.NetworkOverrides
+	}
+	if overrides == nil {
+		return Network{}, fmt.Errorf("network_overrides is not set in the chia config at %s", cfg.ChiaRoot)
+	}
+
+	networkConfig, ok := overrides.Config[*selected]
+	if !ok || networkConfig.AddressPrefix == "" {
+		return Network{}, fmt.Errorf("no address_prefix for network %s in the chia config at %s", *selected, cfg.ChiaRoot)
+	}
+
+	return Network{Name: *selected, AddressPrefix: networkConfig.AddressPrefix}, nil
+}
+
+// initNetwork loads the network from the chia config and connects to its full nodes
+func (m *Metrics) initNetwork(networkConfig NetworkConfig) error {
+	chiaConfig, err := loadChiaConfig(networkConfig.ChiaRoot)
+	if err != nil {
+		return err
+	}
+
+	m.network, err = chiaNetwork(chiaConfig)
+	if err != nil {
+		return err
+	}
+
+	return m.initNodes(chiaConfig, networkConfig.hostnames())
+}
+
+// Network returns the network this instance tracks
+func (m *Metrics) Network() Network {
+	return m.network
+}
+
+// Networks returns the metrics for every network being tracked, starting with this one
+func (m *Metrics) Networks() []*Metrics {
+	return m.networks
+}
+
+// AddNetworks adds the metrics for the rest of the configured networks, so serve can track several networks at once
+// Each network has its own full nodes, lookback windows, and metrics, all labelled with the network. They share the
+// database connection, metrics server, address labels, and entities with this instance
+func (m *Metrics) AddNetworks() error {
+	configured, err := networkConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, networkConfig := range configured[1:] {
+		initialSettings, err := loadSettings(viper.GetInt("lookback-window"), nil)
+		if err != nil {
+			return err
+		}
+
+		network := &Metrics{
+			exporterPort:       m.exporterPort,
+			dbDriver:           m.dbDriver,
+			dbHost:             m.dbHost,
+			dbPort:             m.dbPort,
+			dbUser:             m.dbUser,
+			dbPass:             m.dbPass,
+			dbName:             m.dbName,
+			registry:           m.registry,
+			prometheusMetrics:  &prometheusMetrics{},
+			rpcPerPage:         m.rpcPerPage,
+			entities:           m.entities,
+			labels:             m.labels,
+			nodeLock:           &sync.Mutex{},
+			nodeConsensusCheck: m.nodeConsensusCheck,
+			countCoins:         m.countCoins,
+			refreshing:         &sync.Mutex{},
+			peakLock:           &sync.Mutex{},
+			fillGapsLock:       &sync.Mutex{},
+			stopLock:           m.stopLock,
+			inFlight:           m.inFlight,
+			workCtx:            m.workCtx,
+			cancelWork:         m.cancelWork,
+		}
+
+		err = network.initNetwork(networkConfig)
+		if err != nil {
+			return err
+		}
+		for _, existing := range m.networks {
+			if existing.network.Name == network.network.Name {
+				return fmt.Errorf("network %s is configured more than once", network.network.Name)
+			}
+		}
+
+		network.store = m.store.ForNetwork(network.network.Name)
+		network.initMetrics()
+		network.applySettings(initialSettings)
+		network.setActiveNode(network.nodes[0])
+
+		m.networks = append(m.networks, network)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/chia-network/go-chia-libs/pkg/streamable"
+	"github.com/chia-network/go-chia-libs/pkg/types"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+// nodeDB reads blocks from a copy of a full node's v2 blockchain database, instead of the full node RPC
+// The blocks are stored zstd compressed, in the streamable format, in the full_blocks table
+type nodeDB struct {
+	db      *sql.DB
+	decoder *zstd.Decoder
+}
+
+// openNodeDB opens the full node database at the path read only, and checks it is a v2 database
+func openNodeDB(path string) (*nodeDB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+
+	var version int
+	err = db.QueryRow("select version from database_version").Scan(&version)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error reading the version of the full node database %s: %w", path, err), db.Close())
+	}
+	if version != 2 {
+		return nil, errors.Join(fmt.Errorf("full node database %s is version %d. Only version 2 is supported", path, version), db.Close())
+	}
+
+	// A nil reader only supports DecodeAll, which is safe to call from the backfill workers concurrently
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return &nodeDB{db: db, decoder: decoder}, nil
+}
+
+// close closes the full node database
+func (n *nodeDB) close() error {
+	n.decoder.Close()
+	return n.db.Close()
+}
+
+// peakHeight returns the height of the highest block in the main chain
+func (n *nodeDB) peakHeight(ctx context.Context) (uint32, error) {
+	var height sql.NullInt64
+	err := n.db.QueryRowContext(ctx, "select max(height) from full_blocks where in_main_chain = 1").Scan(&height)
+	if err != nil {
+		return 0, err
+	}
+	if !height.Valid {
+		return 0, fmt.Errorf("full node database has no blocks")
+	}
+
+	return uint32(height.Int64), nil
+}
+
+// blocks returns the main chain blocks from start up to, but not including, end, the same as the GetBlocks RPC
+func (n *nodeDB) blocks(ctx context.Context, start, end uint32) ([]types.FullBlock, error) {
+	rows, err := n.db.QueryContext(ctx, "select height, block from full_blocks where in_main_chain = 1 and height >= ? and height < ? order by height asc", start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var blocks []types.FullBlock
+	for rows.Next() {
+		var (
+			height     uint32
+			compressed []byte
+		)
+		err = rows.Scan(&height, &compressed)
+		if err != nil {
+			return nil, err
+		}
+
+		serialized, err := n.decoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing block %d: %w", height, err)
+		}
+		var block types.FullBlock
+		err = streamable.Unmarshal(serialized, &block)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding block %d: %w", height, err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// countAdditionsAndRemovals sets the number of coins created and spent by the transactions in the block on the record,
+// from the coin records in the full node database. Reward coins are not part of the transactions, so they are left out
+func (n *nodeDB) countAdditionsAndRemovals(ctx context.Context, record *BlockRecord) error {
+	err := n.db.QueryRowContext(ctx, "select count(*) from coin_record where confirmed_index = ? and coinbase = 0", record.Height).Scan(&record.Transactions.Additions)
+	if err != nil {
+		return fmt.Errorf("error counting additions for block %d: %w", record.Height, err)
+	}
+
+	err = n.db.QueryRowContext(ctx, "select count(*) from coin_record where spent_index = ?", record.Height).Scan(&record.Transactions.Removals)
+	if err != nil {
+		return fmt.Errorf("error counting removals for block %d: %w", record.Height, err)
+	}
+	record.Transactions.CoinsCounted = true
+
+	return nil
+}
+
+// OpenNodeDB makes the backfill and gap filling read blocks from a copy of the full node's v2 blockchain database,
+// such as blockchain_v2_mainnet.sqlite, instead of the full node RPC
+func (m *Metrics) OpenNodeDB(path string) error {
+	db, err := openNodeDB(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading blocks from the full node database %s\n", path)
+	m.nodeDB = db
+
+	return nil
+}
+
+// CloseNodeDB closes the full node database, if one is open
+func (m *Metrics) CloseNodeDB() error {
+	if m.nodeDB == nil {
+		return nil
+	}
+	err := m.nodeDB.close()
+	m.nodeDB = nil
+
+	return err
+}
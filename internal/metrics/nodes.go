@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/chia-network/go-chia-libs/pkg/config"
+	"github.com/chia-network/go-chia-libs/pkg/rpc"
+	"github.com/chia-network/go-chia-libs/pkg/types"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// The ways serve can receive new blocks from the full nodes
+const (
+	IngestModeWebsocket = "websocket"
+	IngestModePoll      = "poll"
+)
+
+// recentPeaksSize is how many of the most recent peak header hashes are remembered, so the same block announced by
+// several nodes is only processed once
+const recentPeaksSize = 32
+
+// fullNode is a connection to one of the configured full nodes
+// Every node is subscribed to or polled for new blocks, while other requests go to the active node
+type fullNode struct {
+	hostname string
+
+	websocketClient *rpc.Client
+	handlerID       uuid.UUID
+	subscribed      bool
+
+	// rpcClient is an HTTP client for bulk requests. Unlike the sync websocket client, it can make concurrent requests
+	rpcClient *rpc.Client
+
+	// client makes the single requests. It is the websocket client, or the HTTP client in poll mode, where only the
+	// full node RPC is needed and there is no websocket client
+	client *rpc.Client
+
+	// healthy is false after the websocket disconnects or a request fails, until a request succeeds or it reconnects
+	healthy atomic.Bool
+}
+
+func newFullNode(chiaConfig *config.ChiaConfig, hostname string, ingestMode string) (*fullNode, error) {
+	var err error
+	node := &fullNode{hostname: hostname}
+	node.healthy.Store(true)
+
+	node.rpcClient, err = rpc.NewClient(rpc.ConnectionModeHTTP, rpc.WithManualConfig(*chiaConfig), rpc.WithBaseURL(&url.URL{
+		Scheme: "https",
+		Host:   hostname,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	node.client = node.rpcClient
+
+	if ingestMode == IngestModePoll {
+		return node, nil
+	}
+
+	node.websocketClient, err = rpc.NewClient(rpc.ConnectionModeWebsocket, rpc.WithManualConfig(*chiaConfig), rpc.WithSyncWebsocket(), rpc.WithBaseURL(&url.URL{
+		Scheme: "wss",
+		Host:   hostname,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	node.client = node.websocketClient
+
+	return node, nil
+}
+
+// ingestMode validates the configured ingest-mode
+func ingestMode() (string, error) {
+	mode := viper.GetString("ingest-mode")
+	if mode != IngestModeWebsocket && mode != IngestModePoll {
+		return "", fmt.Errorf("invalid ingest-mode %s. Must be one of %s, %s", mode, IngestModeWebsocket, IngestModePoll)
+	}
+
+	return mode, nil
+}
+
+// initNodes connects to every full node, using the certs from the chia config. The first node starts as the active node
+func (m *Metrics) initNodes(chiaConfig *config.ChiaConfig, hostnames []string) error {
+	mode, err := ingestMode()
+	if err != nil {
+		return err
+	}
+
+	for _, hostname := range hostnames {
+		node, err := newFullNode(chiaConfig, hostname, mode)
+		if err != nil {
+			return fmt.Errorf("error creating the RPC clients for %s: %w", hostname, err)
+		}
+		m.nodes = append(m.nodes, node)
+	}
+
+	return nil
+}
+
+// activeNode returns the node requests are sent to first
+func (m *Metrics) activeNode() *fullNode {
+	m.nodeLock.Lock()
+	defer m.nodeLock.Unlock()
+
+	return m.nodes[m.active]
+}
+
+// setActiveNode makes the node the one requests are sent to first
+func (m *Metrics) setActiveNode(node *fullNode) {
+	m.nodeLock.Lock()
+	defer m.nodeLock.Unlock()
+
+	for i := range m.nodes {
+		if m.nodes[i] != node || i == m.active {
+			continue
+		}
+		log.Warnf("Failing over from full node %s to %s\n", m.nodes[m.active].hostname, node.hostname)
+		m.active = i
+	}
+	m.setNodeGauges()
+}
+
+// setNodeGauges exports which node is active and the health of every node. The caller must hold nodeLock
+func (m *Metrics) setNodeGauges() {
+	for i, node := range m.nodes {
+		active := 0.0
+		if i == m.active {
+			active = 1
+		}
+		healthy := 0.0
+		if node.healthy.Load() {
+			healthy = 1
+		}
+		m.prometheusMetrics.activeNode.WithLabelValues(node.hostname).Set(active)
+		m.prometheusMetrics.nodeHealthy.WithLabelValues(node.hostname).Set(healthy)
+	}
+}
+
+// setNodeHealthy records whether the node is healthy. When the active node becomes unhealthy, the first healthy node
+// takes over
+func (m *Metrics) setNodeHealthy(node *fullNode, healthy bool) {
+	if node.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		log.Printf("Full node %s is healthy\n", node.hostname)
+	} else {
+		log.Warnf("Full node %s is unhealthy\n", node.hostname)
+	}
+
+	if !healthy && m.activeNode() == node {
+		for _, other := range m.nodes {
+			if other.healthy.Load() {
+				m.setActiveNode(other)
+				return
+			}
+		}
+	}
+
+	m.nodeLock.Lock()
+	defer m.nodeLock.Unlock()
+	m.setNodeGauges()
+}
+
+// nodesInOrder returns the nodes in the order requests should try them. The preferred node, if not nil, is first,
+// followed by the active node, the other healthy nodes, and finally the unhealthy nodes as a last resort
+func (m *Metrics) nodesInOrder(preferred *fullNode) []*fullNode {
+	active := m.activeNode()
+	ordered := []*fullNode{}
+	if preferred != nil {
+		ordered = append(ordered, preferred)
+	}
+	if active != preferred {
+		ordered = append(ordered, active)
+	}
+	for _, healthy := range []bool{true, false} {
+		for _, node := range m.nodes {
+			if node != preferred && node != active && node.healthy.Load() == healthy {
+				ordered = append(ordered, node)
+			}
+		}
+	}
+
+	return ordered
+}
+
+// withNode runs the request against the full nodes, in the order of nodesInOrder, until one succeeds
+// If the active node fails and another node succeeds, the node that succeeded becomes the active node
+func (m *Metrics) withNode(preferred *fullNode, request func(node *fullNode) error) error {
+	active := m.activeNode()
+	activeFailed := false
+
+	var errs []error
+	for _, node := range m.nodesInOrder(preferred) {
+		err := request(node)
+		if err != nil {
+			m.prometheusMetrics.nodeRequestFailures.WithLabelValues(node.hostname).Inc()
+			if len(m.nodes) > 1 {
+				log.Warnf("Request to full node %s failed: %s\n", node.hostname, err.Error())
+				err = fmt.Errorf("%s: %w", node.hostname, err)
+			}
+			errs = append(errs, err)
+			m.setNodeHealthy(node, false)
+			if node == active {
+				activeFailed = true
+			}
+			continue
+		}
+
+		m.setNodeHealthy(node, true)
+		if activeFailed {
+			m.setActiveNode(node)
+		}
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// claimPeak returns true the first time a peak is seen, so a block announced by several nodes is only processed once
+func (m *Metrics) claimPeak(headerHash types.Bytes32) bool {
+	m.nodeLock.Lock()
+	defer m.nodeLock.Unlock()
+
+	for _, seen := range m.recentPeaks {
+		if seen == headerHash {
+			return false
+		}
+	}
+	m.recentPeaks = append(m.recentPeaks, headerHash)
+	if len(m.recentPeaks) > recentPeaksSize {
+		m.recentPeaks = m.recentPeaks[1:]
+	}
+
+	return true
+}
+
+// checkNodeConsensus compares the header hash at the block's height on every other node with the block's header hash,
+// and records any node that disagrees. Nodes that don't have the height yet are skipped
+func (m *Metrics) checkNodeConsensus(source *fullNode, block types.FullBlock) {
+	hash, err := headerHash(block)
+	if err != nil {
+		log.Errorf("Error checking full node consensus: %s\n", err.Error())
+		return
+	}
+
+	height := block.RewardChainBlock.Height
+	for _, node := range m.nodes {
+		if node == source {
+			continue
+		}
+		record, _, err := node.client.FullNodeService.GetBlockRecordByHeight(&rpc.GetBlockByHeightOptions{BlockHeight: int(height)})
+		if err != nil || record == nil || record.BlockRecord.IsAbsent() {
+			continue
+		}
+		if nodeHash := record.BlockRecord.MustGet().HeaderHash; nodeHash != hash {
+			log.Warnf("Full node %s has header hash %s at height %d, but %s has %s\n", node.hostname, nodeHash.String(), height, source.hostname, hash.String())
+			m.prometheusMetrics.nodeConsensusMismatches.WithLabelValues(node.hostname).Inc()
+		}
+	}
+}
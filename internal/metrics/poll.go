@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Poll checks every full node for a new peak on the interval until ctx is done
+// This is the poll ingest mode, which only needs the full node RPC, instead of subscribing through the daemon websocket
+func (m *Metrics) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, node := range m.nodes {
+			if ctx.Err() != nil {
+				return
+			}
+			m.pollNode(node)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollNode gets the node's peak, and processes it the same as a peak announced over the websocket if it's new
+func (m *Metrics) pollNode(node *fullNode) {
+	if !m.startWork() {
+		return
+	}
+	defer m.inFlight.Done()
+
+	state, _, err := node.rpcClient.FullNodeService.GetBlockchainState()
+	if err == nil && (state.BlockchainState.IsAbsent() || state.BlockchainState.MustGet().Peak.IsAbsent()) {
+		err = fmt.Errorf("blockchain state or peak not present in the response")
+	}
+	if err != nil {
+		m.prometheusMetrics.nodeRequestFailures.WithLabelValues(node.hostname).Inc()
+		log.Errorf("Error polling full node %s: %s\n", node.hostname, err.Error())
+		m.setNodeHealthy(node, false)
+		return
+	}
+	m.setNodeHealthy(node, true)
+
+	peak := state.BlockchainState.MustGet().Peak.MustGet()
+	m.prometheusMetrics.nodePeakHeight.WithLabelValues(node.hostname).Set(float64(peak.Height))
+
+	// The peak is the same until the node gets a new block, and every node has the same peaks, so each peak is only
+	// processed once
+	if !m.claimPeak(peak.HeaderHash) {
+		return
+	}
+	log.Printf("Polled new peak %d from %s\n", peak.Height, node.hostname)
+
+	m.processPeak(m.workCtx, node, peak.Height)
+}
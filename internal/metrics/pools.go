@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PoolMetrics are the decentralization measures for the lookback window with blocks grouped by pool address, instead
+// of farmer address. With plotNFTs, the farmer address is usually the farmer's own, while the pool address identifies
+// the pool contract
+type PoolMetrics struct {
+	// NakamotoCoefficients is the pool NC for each configured threshold
+	NakamotoCoefficients map[int]int
+
+	// TopPoolsPercent is the percentage of the window won by the top-farmers-count pool addresses
+	TopPoolsPercent float64
+
+	// HHI is the Herfindahl-Hirschman Index of the share of blocks won by each pool address
+	HHI float64
+
+	// PooledPercent and SoloPercent are the share of the blocks won by plotNFT plots and original plots. Plots that are
+	// self pooling with a plotNFT count as pooled
+	PooledPercent float64
+	SoloPercent   float64
+}
+
+// GetPoolDistribution returns the number of blocks each pool address won in the lookback window ending at the peak height
+func (m *Metrics) GetPoolDistribution(ctx context.Context, peakHeight uint32, lookbackWindow uint32) ([]FarmerBlocks, error) {
+	if peakHeight < lookbackWindow {
+		return nil, notEnoughBlocksError{lookbackWindow: lookbackWindow}
+	}
+
+	return m.store.GetPoolDistribution(ctx, peakHeight-lookbackWindow, peakHeight)
+}
+
+// CalculatePoolMetrics calculates the pool metrics for the lookback window ending at the peak height
+// Blocks saved without the pool details are left out of the distribution, but still count towards the total, the same
+// as ignored addresses in the adjusted NC
+func (m *Metrics) CalculatePoolMetrics(ctx context.Context, peakHeight uint32, lookbackWindow uint32) (PoolMetrics, error) {
+	return m.calculatePoolMetrics(ctx, m.config(), peakHeight, lookbackWindow)
+}
+
+func (m *Metrics) calculatePoolMetrics(ctx context.Context, settings *settings, peakHeight uint32, lookbackWindow uint32) (PoolMetrics, error) {
+	distribution, err := m.GetPoolDistribution(ctx, peakHeight, lookbackWindow)
+	if err != nil {
+		return PoolMetrics{}, err
+	}
+
+	poolMetrics := PoolMetrics{NakamotoCoefficients: map[int]int{}}
+	for _, threshold := range settings.nakamotoThresholds {
+		poolMetrics.NakamotoCoefficients[threshold], err = nakamotoCoefficient(distribution, lookbackWindow, threshold)
+		if err != nil {
+			return PoolMetrics{}, err
+		}
+	}
+
+	for _, rank := range rankFarmers(distribution, lookbackWindow, 0, settings.topFarmersCount) {
+		poolMetrics.TopPoolsPercent += rank.Percent
+	}
+
+	indices, err := decentralizationIndices(distribution)
+	if err != nil {
+		return PoolMetrics{}, err
+	}
+	poolMetrics.HHI = indices.HHI
+
+	totals, err := m.store.GetPlotTypeTotals(ctx, peakHeight-lookbackWindow, peakHeight)
+	if err != nil {
+		return PoolMetrics{}, err
+	}
+	if known := totals.Pooled + totals.Solo; known > 0 {
+		poolMetrics.PooledPercent = float64(totals.Pooled) / float64(known) * 100
+		poolMetrics.SoloPercent = float64(totals.Solo) / float64(known) * 100
+	}
+
+	return poolMetrics, nil
+}
+
+// refreshPoolMetrics sets the pool gauges for the primary lookback window
+func (m *Metrics) refreshPoolMetrics(ctx context.Context, settings *settings, peakHeight uint32) {
+	poolMetrics, err := m.calculatePoolMetrics(ctx, settings, peakHeight, settings.lookbackWindow)
+	if err != nil {
+		log.Errorf("Error calculating the pool metrics: %s\n", err.Error())
+		return
+	}
+
+	for threshold, nakamoto := range poolMetrics.NakamotoCoefficients {
+		m.prometheusMetrics.poolNakamotoCoefficient.WithLabelValues(strconv.Itoa(threshold)).Set(float64(nakamoto))
+	}
+	m.prometheusMetrics.topPoolsPercent.Set(poolMetrics.TopPoolsPercent)
+	m.prometheusMetrics.poolHHI.Set(poolMetrics.HHI)
+	m.prometheusMetrics.plotTypePercent.WithLabelValues("pooled").Set(poolMetrics.PooledPercent)
+	m.prometheusMetrics.plotTypePercent.WithLabelValues("solo").Set(poolMetrics.SoloPercent)
+}
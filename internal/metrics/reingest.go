@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReingestBlocks fetches blocks that are already stored from the full node again and updates the stored records, to fill
+// in the block details for blocks that were saved before the details were stored, or the coin counts with count-coins
+// Only blocks missing the details are fetched, unless all is true, in which case every block between the oldest and
+// newest block in the DB is fetched again
+func (m *Metrics) ReingestBlocks(ctx context.Context, workers int, all bool) error {
+	var ranges []BlockGap
+	if all {
+		oldest, err := m.GetOldestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		newest, err := m.GetNewestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		ranges = []BlockGap{{Start: oldest, End: newest}}
+	} else {
+		heights, err := m.store.GetHeightsMissingDetails(ctx, m.countCoinsInBatches())
+		if err != nil {
+			return err
+		}
+		ranges = heightRanges(heights)
+	}
+
+	var pages []backfillPage
+	for _, heightRange := range ranges {
+		pages = append(pages, splitPages(heightRange.Start, heightRange.End+1, m.rpcPerPage)...)
+	}
+	if len(pages) == 0 {
+		log.Println("No blocks to re-ingest")
+		return nil
+	}
+
+	return m.fetchAndSavePages(ctx, pages, workers, nil)
+}
+
+// heightRanges groups the sorted heights into ranges of consecutive heights
+func heightRanges(heights []uint32) []BlockGap {
+	var ranges []BlockGap
+	for _, height := range heights {
+		if len(ranges) > 0 && ranges[len(ranges)-1].End+1 == height {
+			ranges[len(ranges)-1].End = height
+			continue
+		}
+		ranges = append(ranges, BlockGap{Start: height, End: height})
+	}
+
+	return ranges
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/chia-network/go-chia-libs/pkg/rpc"
+	"github.com/chia-network/go-chia-libs/pkg/streamable"
+	"github.com/chia-network/go-chia-libs/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// headerHash returns the header hash for the block, which is the hash of the serialized foliage
+func headerHash(block types.FullBlock) (types.Bytes32, error) {
+	foliage, err := streamable.Marshal(block.Foliage)
+	if err != nil {
+		return types.Bytes32{}, fmt.Errorf("unable to serialize foliage for block %d: %w", block.RewardChainBlock.Height, err)
+	}
+
+	return sha256.Sum256(foliage), nil
+}
+
+// handleReorg checks if the new peak builds on the chain we have stored in the DB
+// If it doesn't, the orphaned heights are removed from the DB. The peak itself is saved by the caller, and the gap
+// between the fork point and the new peak is filled with the canonical blocks the next time FillBlockGaps runs
+// The refreshing lock is held for the whole check and rollback, so metrics being calculated for another peak can't
+// advance the in memory windows across the orphaned heights, or publish metrics from blocks that are being deleted
+func (m *Metrics) handleReorg(ctx context.Context, node *fullNode, block types.FullBlock) error {
+	m.refreshing.Lock()
+	defer m.refreshing.Unlock()
+
+	orphanedHeight, orphaned, err := m.findOrphanedHeight(ctx, node, block)
+	if err != nil {
+		return err
+	}
+	if !orphaned {
+		return nil
+	}
+
+	newest, err := m.GetNewestBlock(ctx)
+	if err != nil {
+		return err
+	}
+	depth := newest - orphanedHeight + 1
+
+	log.Warnf("Chain reorganization detected at height %d. Rolling back %d blocks\n", orphanedHeight, depth)
+	err = m.deleteBlocksFrom(ctx, orphanedHeight)
+	if err != nil {
+		return err
+	}
+
+	for _, engine := range m.config().engines {
+		engine.reset()
+	}
+	m.prometheusMetrics.reorgCount.Inc()
+	m.prometheusMetrics.reorgDepth.Set(float64(depth))
+
+	// The metrics were calculated from the orphaned blocks, so make sure they are recalculated even if the new peak
+	// is not higher than the peak we had before the reorg
+	m.peakLock.Lock()
+	if orphanedHeight > 0 && m.highestPeak >= orphanedHeight {
+		m.highestPeak = orphanedHeight - 1
+	}
+	m.peakLock.Unlock()
+
+	return nil
+}
+
+// findOrphanedHeight walks back from the new peak, comparing the header hashes stored in the DB against the canonical
+// chain, and returns the lowest stored height that is no longer part of the canonical chain
+// The bool return value is false when all the stored blocks are still canonical
+func (m *Metrics) findOrphanedHeight(ctx context.Context, node *fullNode, block types.FullBlock) (uint32, bool, error) {
+	var (
+		orphanedHeight uint32
+		orphaned       bool
+	)
+
+	peakHeight := block.RewardChainBlock.Height
+	peakHash, err := headerHash(block)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// A different block stored at the peak height is orphaned, along with everything above it
+	// A node that is behind or resyncing announces peaks below the newest stored block. When the peak is the block we
+	// have stored at its height, it and its parents are already on our chain, so there is nothing to roll back, even if
+	// there are blocks stored above it
+	storedHeight, storedHash, err := m.getStoredHeaderHash(ctx, peakHeight)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if storedHeight == peakHeight && storedHash.Valid {
+		if storedHash.String == peakHash.String() {
+			return 0, false, nil
+		}
+		orphanedHeight = peakHeight
+		orphaned = true
+	}
+
+	if peakHeight == 0 {
+		return orphanedHeight, orphaned, nil
+	}
+
+	checkHeight := peakHeight - 1
+	for {
+		// Gets the highest stored block at or below the height we are checking, so we step over any gaps
+		storedHeight, storedHash, err := m.getStoredHeaderHash(ctx, checkHeight)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return orphanedHeight, orphaned, nil
+			}
+			return 0, false, err
+		}
+
+		// Blocks stored before header hashes were tracked can't be compared, so assume they are canonical
+		if !storedHash.Valid {
+			return orphanedHeight, orphaned, nil
+		}
+
+		canonicalHash, err := m.canonicalHeaderHash(ctx, node, block, storedHeight)
+		if err != nil {
+			return 0, false, err
+		}
+		if storedHash.String == canonicalHash.String() {
+			return orphanedHeight, orphaned, nil
+		}
+
+		orphanedHeight = storedHeight
+		orphaned = true
+		if storedHeight == 0 {
+			return orphanedHeight, orphaned, nil
+		}
+		checkHeight = storedHeight - 1
+	}
+}
+
+// canonicalHeaderHash returns the header hash of the block at the given height on the chain the peak belongs to
+// The node the peak came from is asked, since other nodes may not have switched to the same chain yet
+func (m *Metrics) canonicalHeaderHash(ctx context.Context, node *fullNode, peak types.FullBlock, height uint32) (types.Bytes32, error) {
+	// The parent of the peak is already known, so we can save the RPC call for the common case
+	if height+1 == peak.RewardChainBlock.Height {
+		return peak.Foliage.PrevBlockHash, nil
+	}
+
+	record, _, err := node.client.FullNodeService.GetBlockRecordByHeight(&rpc.GetBlockByHeightOptions{BlockHeight: int(height)})
+	if err != nil {
+		return types.Bytes32{}, err
+	}
+	if record == nil || record.BlockRecord.IsAbsent() {
+		return types.Bytes32{}, fmt.Errorf("block record for height %d was not present in the response", height)
+	}
+
+	return record.BlockRecord.MustGet().HeaderHash, nil
+}
+
+// getStoredHeaderHash returns the height and header hash of the highest block in the DB at or below the given height
+func (m *Metrics) getStoredHeaderHash(ctx context.Context, height uint32) (uint32, sql.NullString, error) {
+	return m.store.GetHeaderHash(ctx, height)
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chia-network/go-chia-libs/pkg/types"
+)
+
+// testPeak returns a block at the height on the fork, building on the parent hash
+func testPeak(t *testing.T, height uint32, fork byte, parent types.Bytes32) (types.FullBlock, types.Bytes32) {
+	t.Helper()
+
+	var block types.FullBlock
+	block.RewardChainBlock.Height = height
+	block.Foliage.PrevBlockHash = parent
+	block.Foliage.RewardBlockHash = types.Bytes32{fork, byte(height)}
+	hash, err := headerHash(block)
+	if err != nil {
+		t.Fatalf("error hashing block %d: %s", height, err.Error())
+	}
+	return block, hash
+}
+
+// TestFindOrphanedHeight checks that a peak below the newest stored block is only a reorg when it isn't the block
+// already stored at its height
+func TestFindOrphanedHeight(t *testing.T) {
+	ctx := context.Background()
+	m := &Metrics{network: Network{Name: "mainnet"}, store: newTestStore(t)}
+
+	var (
+		stored []BlockRecord
+		peaks  []types.FullBlock
+		hashes []types.Bytes32
+		parent types.Bytes32
+	)
+	for height := uint32(0); height <= 10; height++ {
+		block, hash := testPeak(t, height, 1, parent)
+		stored = append(stored, BlockRecord{Height: height, FarmerAddress: "xch1farmer", HeaderHash: hash.String(), PrevHeaderHash: parent.String()})
+		peaks = append(peaks, block)
+		hashes = append(hashes, hash)
+		parent = hash
+	}
+	err := m.store.SaveBlocks(ctx, stored)
+	if err != nil {
+		t.Fatalf("error saving blocks: %s", err.Error())
+	}
+
+	// A node that is behind announces a peak we already have
+	_, orphaned, err := m.findOrphanedHeight(ctx, nil, peaks[5])
+	if err != nil || orphaned {
+		t.Fatalf("stored lower peak: orphaned %t, error %v", orphaned, err)
+	}
+
+	// A different block at a lower height, building on our chain, orphans the stored block at its height
+	fork, _ := testPeak(t, 5, 2, hashes[4])
+	height, orphaned, err := m.findOrphanedHeight(ctx, nil, fork)
+	if err != nil || !orphaned || height != 5 {
+		t.Fatalf("forked lower peak: orphaned %t at %d, error %v", orphaned, height, err)
+	}
+
+	// The next block on our chain
+	next, _ := testPeak(t, 11, 1, hashes[10])
+	_, orphaned, err = m.findOrphanedHeight(ctx, nil, next)
+	if err != nil || orphaned {
+		t.Fatalf("next peak: orphaned %t, error %v", orphaned, err)
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,13 +10,45 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// StartServer starts the metrics server
+// SetupServer creates the metrics server, so it can be stopped by Shutdown from the moment the app is started. It must be
+// called before StartServer, and before the goroutine StartServer runs in is started
+func (m *Metrics) SetupServer() {
+	// The server has its own mux, so handlers registered on the default mux by dependencies aren't exposed
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", healthcheckEndpoint)
+	m.registerAPI(mux)
+
+	m.server = &http.Server{Addr: fmt.Sprintf(":%d", m.exporterPort), Handler: mux}
+}
+
+// StartServer starts the metrics server created by SetupServer, and blocks until it stops
 func (m *Metrics) StartServer() error {
+	if m.server == nil {
+		return errors.New("the metrics server must be set up before it is started")
+	}
+
 	log.Printf("Starting metrics server on port %d", m.exporterPort)
+	err := m.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// stopServer stops accepting new requests and waits for active requests to finish, until ctx is done
+func (m *Metrics) stopServer(ctx context.Context) error {
+	if m.server == nil {
+		return nil
+	}
+
+	err := m.server.Shutdown(ctx)
+	if err != nil {
+		// Out of time waiting for requests, so close the remaining connections
+		return errors.Join(err, m.server.Close())
+	}
 
-	http.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
-	http.HandleFunc("/healthz", healthcheckEndpoint)
-	return http.ListenAndServe(fmt.Sprintf(":%d", m.exporterPort), nil)
+	return nil
 }
 
 // Healthcheck endpoint for metrics server
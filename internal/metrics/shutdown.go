@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Shutdown stops the app in order, so no block is left half processed
+// New websocket events are ignored, then the blocks being processed are given until ctx is done to finish before
+// they are cancelled. Then the metrics server, the RPC client, and the database connection are closed
+// Every network is stopped, since they share the work being waited for and the database connection
+func (m *Metrics) Shutdown(ctx context.Context) error {
+	log.Println("Ignoring new websocket events")
+	for _, network := range m.networks {
+		network.stopReceiving()
+	}
+
+	log.Println("Waiting for blocks being processed to finish")
+	drained := make(chan struct{})
+	go func() {
+		m.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Warnln("Timed out waiting for blocks being processed. Cancelling them")
+		m.cancelWork()
+		<-drained
+	}
+	m.cancelWork()
+
+	var errs []error
+
+	log.Println("Stopping metrics server")
+	err := m.stopServer(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	log.Println("Closing RPC client")
+	for _, network := range m.networks {
+		err = network.CloseWebsocket()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Println("Closing database connection")
+	err = m.store.Close()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
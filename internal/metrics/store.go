@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BlockRecord is the data we store in the DB for each block
+type BlockRecord struct {
+	Height           uint32
+	Timestamp        sql.NullTime
+	TransactionBlock bool
+	FarmerPuzzleHash string
+	FarmerAddress    string
+	HeaderHash       string
+	PrevHeaderHash   string
+
+	// The block details below are empty for blocks saved before they were stored, until the blocks are re-ingested
+
+	// Weight and TotalIters are 128 bit integers, stored as decimal strings
+	Weight               string
+	TotalIters           string
+	SignagePointIndex    uint8
+	PoolTargetPuzzleHash string
+	// PoolAddress is the address the pool reward was sent to. For plotNFT plots this identifies the pool contract
+	PoolAddress string
+	// Only one of PoolPublicKey and PoolContractPuzzleHash is set. PoolContractPuzzleHash is set for plots using a
+	// pool plotNFT, and PoolPublicKey for original plots
+	PoolPublicKey          sql.NullString
+	PoolContractPuzzleHash sql.NullString
+	PlotPublicKey          string
+	KSize                  uint8
+
+	// Transactions is only set for transaction blocks
+	Transactions *BlockTransactions
+}
+
+// BlockTransactions is the transactions info for a transaction block
+type BlockTransactions struct {
+	// Fees is the total fees in mojos
+	Fees uint64
+	// Cost is the total CLVM cost of the transactions
+	Cost uint64
+	// Additions and Removals are the number of coins created and spent by the transactions, not including reward coins
+	// They are only set when CoinsCounted, since counting them takes a request per block
+	Additions    uint32
+	Removals     uint32
+	CoinsCounted bool
+	// RewardClaims is the number of reward coins claimed by the block, and RewardClaimsAmount their total in mojos
+	RewardClaims       uint32
+	RewardClaimsAmount uint64
+}
+
+// PlotTypeTotals are the number of blocks won by each type of plot in a range of blocks
+type PlotTypeTotals struct {
+	// Pooled is the number of blocks won by plotNFT plots, which have a pool contract puzzle hash
+	Pooled uint32
+	// Solo is the number of blocks won by original plots, which have a pool public key
+	Solo uint32
+}
+
+// TransactionTotals are the totals of the transactions info for the transaction blocks in a range of blocks
+type TransactionTotals struct {
+	TransactionBlocks uint32
+	Fees              float64
+	Cost              float64
+
+	// Removals is the total of the transaction blocks with their coins counted. CoinBlocks is the number of those
+	// blocks, and FirstCoinHeight and LastCoinHeight are the lowest and highest of their heights
+	Removals        float64
+	CoinBlocks      uint32
+	FirstCoinHeight uint32
+	LastCoinHeight  uint32
+}
+
+// BlockGap is a range of missing blocks in the DB. Both start and end are inclusive
+type BlockGap struct {
+	Start uint32
+	End   uint32
+}
+
+// FarmerBlocks is the number of blocks a farmer address won in a range of blocks
+// The pool distribution uses the same type, with the pool address in FarmerAddress, so the same calculations apply
+type FarmerBlocks struct {
+	FarmerAddress string
+	Blocks        uint32
+}
+
+// BlockFarmer is the farmer address that won the block at a height
+// FarmerAddress is empty if the address is not known for the block
+type BlockFarmer struct {
+	Height        uint32
+	FarmerAddress string
+}
+
+// BackfillCheckpoint is a range of blocks the backfill has finished saving. Both start and end are inclusive
+type BackfillCheckpoint struct {
+	Start uint32
+	End   uint32
+}
+
+// MigrationStatus describes whether a migration has been applied to the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt sql.NullTime
+}
+
+// BlockStore is the storage backend for the block data
+// Every method only reads and writes the blocks of the store's network
+type BlockStore interface {
+	// ForNetwork returns a store for the network's blocks that shares the database connection
+	ForNetwork(network string) BlockStore
+
+	// SaveBlock inserts a single block, or updates it if the height is already stored
+	SaveBlock(ctx context.Context, block BlockRecord) error
+
+	// SaveBlocks inserts the blocks in a single transaction, updating any heights that are already stored
+	// A block without a timestamp does not clear the timestamp already stored for the height
+	SaveBlocks(ctx context.Context, blocks []BlockRecord) error
+
+	// DeleteBlocks deletes all blocks and backfill checkpoints
+	DeleteBlocks(ctx context.Context) error
+
+	// DeleteBlocksFrom deletes all blocks at or above the given height, and removes them from the backfill checkpoints
+	DeleteBlocksFrom(ctx context.Context, height uint32) error
+
+	// GetOldestBlock returns the lowest block height. Returns sql.ErrNoRows if there are no blocks
+	GetOldestBlock(ctx context.Context) (uint32, error)
+
+	// GetNewestBlock returns the highest block height. Returns sql.ErrNoRows if there are no blocks
+	GetNewestBlock(ctx context.Context) (uint32, error)
+
+	// GetHeaderHash returns the height and header hash of the highest block at or below the given height
+	GetHeaderHash(ctx context.Context, height uint32) (uint32, sql.NullString, error)
+
+	// GetBlocks returns up to limit blocks from fromHeight up to and including toHeight, lowest height first
+	GetBlocks(ctx context.Context, fromHeight uint32, toHeight uint32, limit int) ([]BlockRecord, error)
+
+	// GetBlockGaps returns the ranges of missing blocks between the lowest and highest blocks, lowest first
+	GetBlockGaps(ctx context.Context) ([]BlockGap, error)
+
+	// GetTransactionTotals returns the totals of the transactions info for the transaction blocks above minHeight, up
+	// to and including maxHeight. Blocks saved without the transactions info are left out
+	GetTransactionTotals(ctx context.Context, minHeight uint32, maxHeight uint32) (TransactionTotals, error)
+
+	// GetHeightsMissingDetails returns the heights of all blocks without the block details or transactions info,
+	// lowest first. With coins, transaction blocks without the coins counted are included too
+	GetHeightsMissingDetails(ctx context.Context, coins bool) ([]uint32, error)
+
+	// GetHeightsMissingTimestamps returns the heights of all blocks without a timestamp, lowest first
+	GetHeightsMissingTimestamps(ctx context.Context) ([]uint32, error)
+
+	// GetPrecedingTimestamp returns the timestamp of the highest block with a timestamp below height and above minHeight
+	GetPrecedingTimestamp(ctx context.Context, height uint32, minHeight uint32) (sql.NullTime, error)
+
+	// GetTimestamp returns the timestamp of the block at the given height. Returns sql.ErrNoRows if the block is missing
+	GetTimestamp(ctx context.Context, height uint32) (sql.NullTime, error)
+
+	// GetHeightAtTime returns the height of the highest block with a timestamp at or before the given time
+	// Returns sql.ErrNoRows if there are no blocks at or before the time
+	GetHeightAtTime(ctx context.Context, timestamp time.Time) (uint32, error)
+
+	// SetTimestamp sets the timestamp for the block at the given height
+	SetTimestamp(ctx context.Context, height uint32, timestamp sql.NullTime) error
+
+	// CountBlocks returns the number of blocks with a height above minHeight, up to and including maxHeight
+	CountBlocks(ctx context.Context, minHeight uint32, maxHeight uint32) (uint32, error)
+
+	// GetFarmerDistribution returns the number of blocks each farmer address won above minHeight, up to and including
+	// maxHeight, excluding ignoreAddresses. Sorted by number of blocks descending, then farmer address ascending
+	GetFarmerDistribution(ctx context.Context, minHeight uint32, maxHeight uint32, ignoreAddresses []string) ([]FarmerBlocks, error)
+
+	// GetPoolDistribution returns the number of blocks each pool address won above minHeight, up to and including
+	// maxHeight. Sorted by number of blocks descending, then pool address ascending. Blocks saved without the pool
+	// address are left out
+	GetPoolDistribution(ctx context.Context, minHeight uint32, maxHeight uint32) ([]FarmerBlocks, error)
+
+	// GetPlotTypeTotals returns the number of blocks won by pooled and solo plots above minHeight, up to and including
+	// maxHeight
+	GetPlotTypeTotals(ctx context.Context, minHeight uint32, maxHeight uint32) (PlotTypeTotals, error)
+
+	// GetBlockFarmers returns the farmer address for each block above minHeight, up to and including maxHeight,
+	// lowest height first
+	GetBlockFarmers(ctx context.Context, minHeight uint32, maxHeight uint32) ([]BlockFarmer, error)
+
+	// GetBackfillCheckpoints returns every range of blocks the backfill has finished saving
+	GetBackfillCheckpoints(ctx context.Context) ([]BackfillCheckpoint, error)
+
+	// SaveBackfillCheckpoint records that the backfill has finished saving the range of blocks, merged with the
+	// checkpoints that overlap or are next to it
+	SaveBackfillCheckpoint(ctx context.Context, checkpoint BackfillCheckpoint) error
+
+	// CheckSchemaVersion returns an error if the schema is newer than the latest migration this binary knows about
+	CheckSchemaVersion(ctx context.Context) error
+
+	// MigrateUp applies all pending migrations, in order
+	MigrateUp(ctx context.Context) error
+
+	// MigrateDown rolls back the given number of the most recently applied migrations
+	MigrateDown(ctx context.Context, steps int) error
+
+	// MigrationStatus returns every known migration and whether it has been applied
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	// AssignNetwork assigns the blocks and backfill checkpoints saved before they were stored with their network to
+	// the store's network. Returns an error if those blocks have addresses without the address prefix, or if another
+	// network already has blocks, since they could be from either network
+	AssignNetwork(ctx context.Context, addressPrefix string) error
+
+	// Close closes the connection to the database
+	Close() error
+}
+
+// newBlockStore returns the BlockStore implementation for the given driver
+func newBlockStore(driver string, host string, port uint16, user string, pass string, name string) (BlockStore, error) {
+	switch driver {
+	case "mysql":
+		return newMySQLStore(host, port, user, pass, name)
+	case "postgres":
+		return newPostgresStore(host, port, user, pass, name)
+	case "sqlite":
+		return newSQLiteStore(name)
+	default:
+		return nil, fmt.Errorf("unsupported db-driver %s. Must be one of mysql, postgres, sqlite", driver)
+	}
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var mysqlDialect = dialect{
+	name: "mysql",
+	migrationsTable: "CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"  `version` int NOT NULL," +
+		"  `name` varchar(255) NOT NULL," +
+		"  `applied_at` DATETIME NOT NULL," +
+		"  PRIMARY KEY (`version`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;",
+	upsert:      "ON DUPLICATE KEY UPDATE ",
+	upsertValue: "VALUES(%s)",
+}
+
+// newMySQLStore returns a BlockStore backed by MySQL
+func newMySQLStore(host string, port uint16, user string, pass string, name string) (*sqlStore, error) {
+	cfg := mysql.Config{
+		User:                 user,
+		Passwd:               pass,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", host, port),
+		DBName:               name,
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetConnMaxLifetime(time.Minute * 3)
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(10)
+
+	return &sqlStore{db: db, dialect: mysqlDialect}, nil
+}
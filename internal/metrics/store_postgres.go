@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	// Registers the postgres driver with database/sql
+	_ "github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+var postgresDialect = dialect{
+	name:                 "postgres",
+	numberedPlaceholders: true,
+	transactionalDDL:     true,
+	migrationsTable: "CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"  version integer NOT NULL PRIMARY KEY," +
+		"  name varchar(255) NOT NULL," +
+		"  applied_at timestamp NOT NULL" +
+		")",
+	upsert:      "ON CONFLICT (network, height) DO UPDATE SET ",
+	upsertValue: "excluded.%s",
+}
+
+// newPostgresStore returns a BlockStore backed by PostgreSQL
+func newPostgresStore(host string, port uint16, user string, pass string, name string) (*sqlStore, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, pass),
+		Host:     net.JoinHostPort(host, strconv.Itoa(int(port))),
+		Path:     name,
+		RawQuery: url.Values{"sslmode": []string{viper.GetString("db-ssl-mode")}}.Encode(),
+	}
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening postgres connection: %w", err)
+	}
+
+	db.SetConnMaxLifetime(time.Minute * 3)
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(10)
+
+	return &sqlStore{db: db, dialect: postgresDialect}, nil
+}
@@ -0,0 +1,678 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dialect holds the differences between the SQL databases we support
+type dialect struct {
+	// name is also the directory the migrations for this dialect are stored in
+	name string
+
+	// numberedPlaceholders is true when the driver uses $1, $2... placeholders instead of ?
+	numberedPlaceholders bool
+
+	// migrationsTable is the statement that creates the table used to track applied migrations
+	migrationsTable string
+
+	// transactionalDDL is true when schema changes can be rolled back, so each migration runs in a transaction
+	transactionalDDL bool
+
+	// upsert starts the clause appended to an INSERT to update the existing row on a conflict, and upsertValue is the
+	// format for referring to the value that would have been inserted for a column
+	upsert      string
+	upsertValue string
+}
+
+// blockColumns are the columns written for each block, in the order blockValues returns the values
+var blockColumns = []string{
+	"timestamp", "height", "transaction_block", "farmer_puzzle_hash", "farmer_address", "header_hash", "prev_header_hash",
+	"weight", "total_iters", "signage_point_index", "pool_target_puzzle_hash", "pool_public_key",
+	"pool_contract_puzzle_hash", "plot_public_key", "k_size",
+	"fees", "cost", "additions", "removals", "reward_claims", "reward_claims_amount", "pool_address",
+}
+
+// blockValues returns the values to insert for the blockColumns
+func blockValues(block BlockRecord) []interface{} {
+	values := []interface{}{
+		block.Timestamp, block.Height, block.TransactionBlock, block.FarmerPuzzleHash, block.FarmerAddress, block.HeaderHash, block.PrevHeaderHash,
+		nullString(block.Weight), nullString(block.TotalIters), block.SignagePointIndex, nullString(block.PoolTargetPuzzleHash), block.PoolPublicKey,
+		block.PoolContractPuzzleHash, nullString(block.PlotPublicKey), block.KSize,
+	}
+	if block.Transactions == nil {
+		values = append(values, nil, nil, nil, nil, nil, nil)
+	} else {
+		tx := block.Transactions
+		additions := sql.NullInt64{Int64: int64(tx.Additions), Valid: tx.CoinsCounted}
+		removals := sql.NullInt64{Int64: int64(tx.Removals), Valid: tx.CoinsCounted}
+		values = append(values, tx.Fees, tx.Cost, additions, removals, tx.RewardClaims, tx.RewardClaimsAmount)
+	}
+
+	return append(values, nullString(block.PoolAddress))
+}
+
+// nullString stores empty strings as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// upsertBlocks returns the clause that updates every column of a block that is already stored
+// A block without a timestamp keeps the timestamp already stored, since it may have been filled in from another block
+// Saving the same block again without the coins counted keeps the counts already stored
+// MySQL applies the assignments left to right, and later assignments see the columns already updated, so the coin
+// counts are assigned first, while blocks.header_hash is still the hash of the stored block
+func (s *sqlStore) upsertBlocks() string {
+	var coins, assignments []string
+	for _, column := range blockColumns {
+		value := fmt.Sprintf(s.dialect.upsertValue, column)
+		switch column {
+		case "height":
+			continue
+		case "timestamp":
+			value = "COALESCE(" + value + ", blocks.timestamp)"
+		case "additions", "removals":
+			value = "CASE WHEN " + fmt.Sprintf(s.dialect.upsertValue, "header_hash") + " = blocks.header_hash THEN COALESCE(" +
+				value + ", blocks." + column + ") ELSE " + value + " END"
+			coins = append(coins, column+"="+value)
+			continue
+		}
+		assignments = append(assignments, column+"="+value)
+	}
+
+	return s.dialect.upsert + strings.Join(append(coins, assignments...), ", ")
+}
+
+// saveBlocksChunk is the most rows written by a single INSERT, to stay under the databases' placeholder limits
+const saveBlocksChunk = 100
+
+// sqlStore implements BlockStore for any database/sql database, with the differences handled by the dialect
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+
+	// network is the network the blocks are read from and saved to, so several networks can share the tables
+	network string
+}
+
+// ForNetwork returns a store for the network's blocks that shares the database connection
+func (s *sqlStore) ForNetwork(network string) BlockStore {
+	return &sqlStore{db: s.db, dialect: s.dialect, network: network}
+}
+
+// rebind converts the ? placeholders in the query to the placeholder format the dialect uses
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numberedPlaceholders {
+		return query
+	}
+
+	var (
+		builder strings.Builder
+		n       int
+	)
+	for _, char := range query {
+		if char != '?' {
+			builder.WriteRune(char)
+			continue
+		}
+		n++
+		builder.WriteString("$")
+		builder.WriteString(strconv.Itoa(n))
+	}
+
+	return builder.String()
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(query), args...)
+	return err
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func closeRows(rows *sql.Rows) {
+	err := rows.Close()
+	if err != nil {
+		log.Errorf("Could not close rows: %s\n", err.Error())
+	}
+}
+
+// SaveBlock inserts a single block, or updates it if the height is already stored
+func (s *sqlStore) SaveBlock(ctx context.Context, block BlockRecord) error {
+	return s.SaveBlocks(ctx, []BlockRecord{block})
+}
+
+// SaveBlocks inserts the blocks with multi-row inserts in a single transaction, updating any heights already stored
+func (s *sqlStore) SaveBlocks(ctx context.Context, blocks []BlockRecord) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	row := "(?" + strings.Repeat(", ?", len(blockColumns)) + ")"
+	for start := 0; start < len(blocks); start += saveBlocksChunk {
+		chunk := blocks[start:min(start+saveBlocksChunk, len(blocks))]
+
+		query := "INSERT INTO blocks (network, " + strings.Join(blockColumns, ", ") + ") VALUES " +
+			row + strings.Repeat(", "+row, len(chunk)-1) + " " + s.upsertBlocks()
+		args := make([]interface{}, 0, len(chunk)*(len(blockColumns)+1))
+		for _, block := range chunk {
+			args = append(args, s.network)
+			args = append(args, blockValues(block)...)
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(query), args...)
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				log.Errorf("Could not roll back saving blocks: %s\n", rollbackErr.Error())
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBlocks deletes all blocks and backfill checkpoints
+func (s *sqlStore) DeleteBlocks(ctx context.Context) error {
+	err := s.exec(ctx, "DELETE from backfill_checkpoints where network = ?", s.network)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "DELETE from blocks where network = ?", s.network)
+}
+
+// DeleteBlocksFrom deletes all blocks at or above the given height, and removes them from the backfill checkpoints
+// Checkpoints are merged into long ranges, so the ones that start below the height are cut short instead of deleted
+func (s *sqlStore) DeleteBlocksFrom(ctx context.Context, height uint32) error {
+	err := s.exec(ctx, "DELETE from backfill_checkpoints where network = ? and start_height >= ?", s.network, height)
+	if err != nil {
+		return err
+	}
+	err = s.exec(ctx, "UPDATE backfill_checkpoints SET end_height = ? where network = ? and end_height >= ?", int64(height)-1, s.network, height)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "DELETE from blocks where network = ? and height >= ?", s.network, height)
+}
+
+// AssignNetwork assigns the blocks and backfill checkpoints saved before they were stored with their network to the
+// store's network. Returns an error if those blocks have addresses without the address prefix, or if another network
+// already has blocks, since they could be from either network
+func (s *sqlStore) AssignNetwork(ctx context.Context, addressPrefix string) error {
+	var blocks, checkpoints int64
+	err := s.queryRow(ctx, "select count(*) from blocks where network IS NULL").Scan(&blocks)
+	if err != nil {
+		return err
+	}
+	err = s.queryRow(ctx, "select count(*) from backfill_checkpoints where network IS NULL").Scan(&checkpoints)
+	if err != nil {
+		return err
+	}
+	if blocks == 0 && checkpoints == 0 {
+		return nil
+	}
+
+	var address string
+	err = s.queryRow(ctx, "select farmer_address from blocks where network IS NULL and farmer_address NOT LIKE ? limit 1", addressPrefix+"1%").Scan(&address)
+	if err == nil {
+		return fmt.Errorf("the blocks without a network have addresses such as %s, which aren't %s addresses, so they can't be from %s. Set their network by hand before starting", address, addressPrefix, s.network)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var other string
+	err = s.queryRow(ctx, "select network from blocks where network IS NOT NULL and network <> ? limit 1", s.network).Scan(&other)
+	if err == nil {
+		return fmt.Errorf("the blocks without a network could be from %s or %s, which also has blocks. Set their network by hand before starting", s.network, other)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind("UPDATE blocks SET network = ? where network IS NULL"), s.network)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, s.rebind("UPDATE backfill_checkpoints SET network = ? where network IS NULL"), s.network)
+	}
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			log.Errorf("Could not roll back assigning the network: %s\n", rollbackErr.Error())
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Assigned %d blocks and %d backfill checkpoints without a network to %s\n", blocks, checkpoints, s.network)
+	return nil
+}
+
+// GetOldestBlock returns the lowest block height
+func (s *sqlStore) GetOldestBlock(ctx context.Context) (uint32, error) {
+	var height uint32
+	err := s.queryRow(ctx, "select height from blocks where network = ? order by height asc limit 1", s.network).Scan(&height)
+	return height, err
+}
+
+// GetNewestBlock returns the highest block height
+func (s *sqlStore) GetNewestBlock(ctx context.Context) (uint32, error) {
+	var height uint32
+	err := s.queryRow(ctx, "select height from blocks where network = ? order by height desc limit 1", s.network).Scan(&height)
+	return height, err
+}
+
+// GetHeaderHash returns the height and header hash of the highest block at or below the given height
+func (s *sqlStore) GetHeaderHash(ctx context.Context, height uint32) (uint32, sql.NullString, error) {
+	var (
+		storedHeight uint32
+		storedHash   sql.NullString
+	)
+	err := s.queryRow(ctx, "select height, header_hash from blocks where network = ? and height <= ? order by height desc limit 1", s.network, height).Scan(&storedHeight, &storedHash)
+	return storedHeight, storedHash, err
+}
+
+// GetBlocks returns up to limit blocks from fromHeight up to and including toHeight, lowest height first
+func (s *sqlStore) GetBlocks(ctx context.Context, fromHeight uint32, toHeight uint32, limit int) ([]BlockRecord, error) {
+	query := "select height, timestamp, transaction_block, farmer_puzzle_hash, farmer_address, header_hash, prev_header_hash, " +
+		"weight, total_iters, signage_point_index, pool_target_puzzle_hash, pool_public_key, pool_contract_puzzle_hash, " +
+		"plot_public_key, k_size, fees, cost, additions, removals, reward_claims, reward_claims_amount, pool_address " +
+		"from blocks where network = ? and height >= ? and height <= ? order by height asc limit ?"
+
+	rows, err := s.query(ctx, query, s.network, fromHeight, toHeight, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var blocks []BlockRecord
+	for rows.Next() {
+		var (
+			block            BlockRecord
+			farmerPuzzleHash sql.NullString
+			farmerAddress    sql.NullString
+			headerHash       sql.NullString
+			prevHeaderHash   sql.NullString
+			weight           sql.NullString
+			totalIters       sql.NullString
+			spIndex          sql.NullInt16
+			poolTarget       sql.NullString
+			plotPublicKey    sql.NullString
+			kSize            sql.NullInt16
+			fees             sql.NullInt64
+			cost             sql.NullInt64
+			additions        sql.NullInt64
+			removals         sql.NullInt64
+			rewardClaims     sql.NullInt64
+			rewardAmount     sql.NullInt64
+			poolAddress      sql.NullString
+		)
+		err = rows.Scan(&block.Height, &block.Timestamp, &block.TransactionBlock, &farmerPuzzleHash, &farmerAddress, &headerHash, &prevHeaderHash,
+			&weight, &totalIters, &spIndex, &poolTarget, &block.PoolPublicKey, &block.PoolContractPuzzleHash, &plotPublicKey, &kSize,
+			&fees, &cost, &additions, &removals, &rewardClaims, &rewardAmount, &poolAddress)
+		if err != nil {
+			return nil, err
+		}
+		block.Weight = weight.String
+		block.TotalIters = totalIters.String
+		block.SignagePointIndex = uint8(spIndex.Int16)
+		block.PoolTargetPuzzleHash = poolTarget.String
+		block.PlotPublicKey = plotPublicKey.String
+		block.KSize = uint8(kSize.Int16)
+		block.PoolAddress = poolAddress.String
+		if fees.Valid {
+			block.Transactions = &BlockTransactions{
+				Fees:               uint64(fees.Int64),
+				Cost:               uint64(cost.Int64),
+				Additions:          uint32(additions.Int64),
+				Removals:           uint32(removals.Int64),
+				CoinsCounted:       additions.Valid,
+				RewardClaims:       uint32(rewardClaims.Int64),
+				RewardClaimsAmount: uint64(rewardAmount.Int64),
+			}
+		}
+		block.FarmerPuzzleHash = farmerPuzzleHash.String
+		block.FarmerAddress = farmerAddress.String
+		block.HeaderHash = headerHash.String
+		block.PrevHeaderHash = prevHeaderHash.String
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// GetBlockGaps returns the ranges of missing blocks between the lowest and highest blocks, lowest first
+func (s *sqlStore) GetBlockGaps(ctx context.Context) ([]BlockGap, error) {
+	query := "select height + 1 as gap_starts_at, next_height - 1 as gap_ends_at from ( " +
+		"    select height, lead(height) over (order by height) as next_height from blocks where network = ? " +
+		") as heights " +
+		"where next_height > height + 1 order by height asc"
+
+	rows, err := s.query(ctx, query, s.network)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var gaps []BlockGap
+	for rows.Next() {
+		var gap BlockGap
+		err = rows.Scan(&gap.Start, &gap.End)
+		if err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, gap)
+	}
+
+	return gaps, rows.Err()
+}
+
+// GetTransactionTotals returns the totals of the transactions info for the transaction blocks in the height range
+func (s *sqlStore) GetTransactionTotals(ctx context.Context, minHeight uint32, maxHeight uint32) (TransactionTotals, error) {
+	query := "select count(fees), sum(fees), sum(cost), sum(removals), count(removals), " +
+		"min(case when removals IS NOT NULL then height end), max(case when removals IS NOT NULL then height end) from blocks " +
+		"where network = ? and height > ? and height <= ? and fees IS NOT NULL"
+
+	var (
+		totals          TransactionTotals
+		fees            sql.NullFloat64
+		cost            sql.NullFloat64
+		removals        sql.NullFloat64
+		firstCoinHeight sql.NullInt64
+		lastCoinHeight  sql.NullInt64
+	)
+	err := s.queryRow(ctx, query, s.network, minHeight, maxHeight).Scan(&totals.TransactionBlocks, &fees, &cost, &removals,
+		&totals.CoinBlocks, &firstCoinHeight, &lastCoinHeight)
+	totals.Fees = fees.Float64
+	totals.Cost = cost.Float64
+	totals.Removals = removals.Float64
+	totals.FirstCoinHeight = uint32(firstCoinHeight.Int64)
+	totals.LastCoinHeight = uint32(lastCoinHeight.Int64)
+	return totals, err
+}
+
+// GetHeightsMissingDetails returns the heights of all blocks without the block details or transactions info, lowest first
+// With coins, transaction blocks without the coins counted are included too
+func (s *sqlStore) GetHeightsMissingDetails(ctx context.Context, coins bool) ([]uint32, error) {
+	query := "select height from blocks " +
+		"where network = ? " +
+		"and (weight IS NULL " +
+		"or pool_address IS NULL " +
+		"or (transaction_block = ? and (fees IS NULL or (? and removals IS NULL)))) " +
+		"order by height asc"
+
+	rows, err := s.query(ctx, query, s.network, true, coins)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var heights []uint32
+	for rows.Next() {
+		var height uint32
+		err = rows.Scan(&height)
+		if err != nil {
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+
+	return heights, rows.Err()
+}
+
+// GetHeightsMissingTimestamps returns the heights of all blocks without a timestamp, lowest first
+func (s *sqlStore) GetHeightsMissingTimestamps(ctx context.Context) ([]uint32, error) {
+	rows, err := s.query(ctx, "select height from blocks where network = ? and timestamp IS NULL order by height asc", s.network)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var heights []uint32
+	for rows.Next() {
+		var height uint32
+		err = rows.Scan(&height)
+		if err != nil {
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+
+	return heights, rows.Err()
+}
+
+// GetPrecedingTimestamp returns the timestamp of the highest block with a timestamp below height and above minHeight
+func (s *sqlStore) GetPrecedingTimestamp(ctx context.Context, height uint32, minHeight uint32) (sql.NullTime, error) {
+	query := "select timestamp from blocks " +
+		"where network = ? " +
+		"and height < ? " +
+		"and height > ? " +
+		"and timestamp IS NOT NULL order by height desc limit 1"
+
+	var timestamp sql.NullTime
+	err := s.queryRow(ctx, query, s.network, height, minHeight).Scan(&timestamp)
+	return timestamp, err
+}
+
+// GetTimestamp returns the timestamp of the block at the given height
+func (s *sqlStore) GetTimestamp(ctx context.Context, height uint32) (sql.NullTime, error) {
+	var timestamp sql.NullTime
+	err := s.queryRow(ctx, "select timestamp from blocks where network = ? and height = ?", s.network, height).Scan(&timestamp)
+	return timestamp, err
+}
+
+// GetHeightAtTime returns the height of the highest block with a timestamp at or before the given time
+func (s *sqlStore) GetHeightAtTime(ctx context.Context, timestamp time.Time) (uint32, error) {
+	query := "select height from blocks " +
+		"where network = ? " +
+		"and timestamp IS NOT NULL " +
+		"and timestamp <= ? order by timestamp desc, height desc limit 1"
+
+	var height uint32
+	err := s.queryRow(ctx, query, s.network, timestamp.UTC()).Scan(&height)
+	return height, err
+}
+
+// SetTimestamp sets the timestamp for the block at the given height
+func (s *sqlStore) SetTimestamp(ctx context.Context, height uint32, timestamp sql.NullTime) error {
+	return s.exec(ctx, "UPDATE blocks set timestamp=? where network=? and height=?", timestamp, s.network, height)
+}
+
+// CountBlocks returns the number of blocks with a height above minHeight, up to and including maxHeight
+func (s *sqlStore) CountBlocks(ctx context.Context, minHeight uint32, maxHeight uint32) (uint32, error) {
+	var count uint32
+	err := s.queryRow(ctx, "select count(*) from blocks where network = ? and height > ? and height <= ?", s.network, minHeight, maxHeight).Scan(&count)
+	return count, err
+}
+
+// GetFarmerDistribution returns the number of blocks each farmer address won in the height range
+func (s *sqlStore) GetFarmerDistribution(ctx context.Context, minHeight uint32, maxHeight uint32, ignoreAddresses []string) ([]FarmerBlocks, error) {
+	query := "select farmer_address, count(*) as blocks_won from blocks " +
+		"where network = ? and height > ? and height <= ? and farmer_address IS NOT NULL "
+	args := []interface{}{s.network, minHeight, maxHeight}
+	if len(ignoreAddresses) > 0 {
+		query += "and farmer_address NOT IN (?" + strings.Repeat(",?", len(ignoreAddresses)-1) + ") "
+		for _, _ignore := range ignoreAddresses {
+			args = append(args, _ignore)
+		}
+	}
+	query += "group by farmer_address order by blocks_won desc, farmer_address asc"
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var distribution []FarmerBlocks
+	for rows.Next() {
+		var farmer FarmerBlocks
+		err = rows.Scan(&farmer.FarmerAddress, &farmer.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		distribution = append(distribution, farmer)
+	}
+
+	return distribution, rows.Err()
+}
+
+// GetPoolDistribution returns the number of blocks each pool address won in the height range
+func (s *sqlStore) GetPoolDistribution(ctx context.Context, minHeight uint32, maxHeight uint32) ([]FarmerBlocks, error) {
+	query := "select pool_address, count(*) as blocks_won from blocks " +
+		"where network = ? and height > ? and height <= ? and pool_address IS NOT NULL " +
+		"group by pool_address order by blocks_won desc, pool_address asc"
+
+	rows, err := s.query(ctx, query, s.network, minHeight, maxHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var distribution []FarmerBlocks
+	for rows.Next() {
+		var pool FarmerBlocks
+		err = rows.Scan(&pool.FarmerAddress, &pool.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		distribution = append(distribution, pool)
+	}
+
+	return distribution, rows.Err()
+}
+
+// GetPlotTypeTotals returns the number of blocks won by pooled and solo plots in the height range
+func (s *sqlStore) GetPlotTypeTotals(ctx context.Context, minHeight uint32, maxHeight uint32) (PlotTypeTotals, error) {
+	query := "select count(pool_contract_puzzle_hash), count(pool_public_key) from blocks where network = ? and height > ? and height <= ?"
+
+	var totals PlotTypeTotals
+	err := s.queryRow(ctx, query, s.network, minHeight, maxHeight).Scan(&totals.Pooled, &totals.Solo)
+	return totals, err
+}
+
+// GetBlockFarmers returns the farmer address for each block in the height range, lowest height first
+func (s *sqlStore) GetBlockFarmers(ctx context.Context, minHeight uint32, maxHeight uint32) ([]BlockFarmer, error) {
+	rows, err := s.query(ctx, "select height, farmer_address from blocks where network = ? and height > ? and height <= ? order by height asc", s.network, minHeight, maxHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var farmers []BlockFarmer
+	for rows.Next() {
+		var (
+			farmer  BlockFarmer
+			address sql.NullString
+		)
+		err = rows.Scan(&farmer.Height, &address)
+		if err != nil {
+			return nil, err
+		}
+		farmer.FarmerAddress = address.String
+		farmers = append(farmers, farmer)
+	}
+
+	return farmers, rows.Err()
+}
+
+// GetBackfillCheckpoints returns every range of blocks the backfill has finished saving
+func (s *sqlStore) GetBackfillCheckpoints(ctx context.Context) ([]BackfillCheckpoint, error) {
+	rows, err := s.query(ctx, "select start_height, end_height from backfill_checkpoints where network = ? order by start_height asc", s.network)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var checkpoints []BackfillCheckpoint
+	for rows.Next() {
+		var checkpoint BackfillCheckpoint
+		err = rows.Scan(&checkpoint.Start, &checkpoint.End)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// SaveBackfillCheckpoint records that the backfill has finished saving the range of blocks
+// Checkpoints that overlap or are next to the range are merged into it, so a backfill leaves a single row for the
+// range it completed, instead of a row per page
+func (s *sqlStore) SaveBackfillCheckpoint(ctx context.Context, checkpoint BackfillCheckpoint) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = s.mergeBackfillCheckpoint(ctx, tx, checkpoint)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			log.Errorf("Could not roll back saving the backfill checkpoint: %s\n", rollbackErr.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// mergeBackfillCheckpoint replaces the checkpoints that overlap or are next to the range with a single checkpoint
+// covering all of them
+func (s *sqlStore) mergeBackfillCheckpoint(ctx context.Context, tx *sql.Tx, checkpoint BackfillCheckpoint) error {
+	// The end is widened by one, so a checkpoint starting right after the range is merged too. uint64 so it can't wrap
+	adjacent := "network = ? AND start_height <= ? AND end_height + 1 >= ?"
+	args := []interface{}{s.network, uint64(checkpoint.End) + 1, checkpoint.Start}
+
+	var start, end sql.NullInt64
+	err := tx.QueryRowContext(ctx, s.rebind("SELECT MIN(start_height), MAX(end_height) FROM backfill_checkpoints WHERE "+adjacent), args...).Scan(&start, &end)
+	if err != nil {
+		return err
+	}
+	if start.Valid && uint32(start.Int64) < checkpoint.Start {
+		checkpoint.Start = uint32(start.Int64)
+	}
+	if end.Valid && uint32(end.Int64) > checkpoint.End {
+		checkpoint.End = uint32(end.Int64)
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind("DELETE FROM backfill_checkpoints WHERE "+adjacent), args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind("INSERT INTO backfill_checkpoints (network, start_height, end_height, completed_at) VALUES(?, ?, ?, ?)"),
+		s.network, checkpoint.Start, checkpoint.End, time.Now().UTC())
+	return err
+}
+
+// Close closes the connection to the database
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
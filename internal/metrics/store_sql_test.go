@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestStore returns a migrated store backed by a SQLite DB for the mainnet network
+func newTestStore(t *testing.T) BlockStore {
+	t.Helper()
+
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("error opening the test DB: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	err = store.MigrateUp(context.Background())
+	if err != nil {
+		t.Fatalf("error migrating the test DB: %s", err.Error())
+	}
+
+	return store.ForNetwork("mainnet")
+}
+
+// txBlock returns a transaction block at the height with the header hash and coin counts
+func txBlock(height uint32, headerHash string, additions uint32, removals uint32, counted bool) BlockRecord {
+	return BlockRecord{
+		Height:           height,
+		TransactionBlock: true,
+		FarmerAddress:    "xch1farmer",
+		HeaderHash:       headerHash,
+		Transactions: &BlockTransactions{
+			Fees:         1,
+			Additions:    additions,
+			Removals:     removals,
+			CoinsCounted: counted,
+		},
+	}
+}
+
+// TestSaveBlocksCoinCounts checks that saving a block again without the coins counted keeps the stored counts, and that
+// saving a different block at the height replaces them
+func TestSaveBlocksCoinCounts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	saveAndCheck := func(block BlockRecord, wantCounted bool, wantAdditions uint32, wantRemovals uint32) {
+		t.Helper()
+		err := store.SaveBlocks(ctx, []BlockRecord{block})
+		if err != nil {
+			t.Fatalf("error saving block %s: %s", block.HeaderHash, err.Error())
+		}
+		blocks, err := store.GetBlocks(ctx, block.Height, block.Height, 1)
+		if err != nil {
+			t.Fatalf("error reading block %d: %s", block.Height, err.Error())
+		}
+		if len(blocks) != 1 || blocks[0].Transactions == nil {
+			t.Fatalf("block %d wasn't stored with its transactions: %+v", block.Height, blocks)
+		}
+		tx := blocks[0].Transactions
+		if blocks[0].HeaderHash != block.HeaderHash || tx.CoinsCounted != wantCounted || tx.Additions != wantAdditions || tx.Removals != wantRemovals {
+			t.Fatalf("after saving %s: stored hash %s counted %t additions %d removals %d, want counted %t additions %d removals %d",
+				block.HeaderHash, blocks[0].HeaderHash, tx.CoinsCounted, tx.Additions, tx.Removals, wantCounted, wantAdditions, wantRemovals)
+		}
+	}
+
+	saveAndCheck(txBlock(10, "0xaa", 3, 2, true), true, 3, 2)
+	// The same block without the coins counted keeps the counts
+	saveAndCheck(txBlock(10, "0xaa", 0, 0, false), true, 3, 2)
+	// A different block at the height, such as a reorg replacement, doesn't keep the old block's counts
+	saveAndCheck(txBlock(10, "0xbb", 0, 0, false), false, 0, 0)
+	saveAndCheck(txBlock(10, "0xbb", 5, 4, true), true, 5, 4)
+}
+
+// TestUpsertBlocksAssignsCoinsFirst checks that the coin counts are assigned before the header hash for every dialect,
+// since MySQL applies the assignments in order and the counts compare against the stored header hash
+func TestUpsertBlocksAssignsCoinsFirst(t *testing.T) {
+	for _, d := range []dialect{mysqlDialect, postgresDialect, sqliteDialect} {
+		clause := (&sqlStore{dialect: d}).upsertBlocks()
+		hash := strings.Index(clause, ", header_hash=")
+		if hash < 0 {
+			t.Fatalf("%s: header_hash isn't assigned: %s", d.name, clause)
+		}
+		for _, column := range []string{"additions=", "removals="} {
+			index := strings.Index(clause, column)
+			if index < 0 || index > hash {
+				t.Fatalf("%s: %s isn't assigned before header_hash: %s", d.name, column, clause)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Registers the sqlite3 driver with database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = dialect{
+	name:             "sqlite",
+	transactionalDDL: true,
+	migrationsTable: "CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"  version INTEGER NOT NULL PRIMARY KEY," +
+		"  name TEXT NOT NULL," +
+		"  applied_at DATETIME NOT NULL" +
+		")",
+	upsert:      "ON CONFLICT (network, height) DO UPDATE SET ",
+	upsertValue: "excluded.%s",
+}
+
+// newSQLiteStore returns a BlockStore backed by an embedded SQLite database stored at the given path
+func newSQLiteStore(path string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer, so sharing one connection avoids "database is locked" errors
+	// This also keeps in-memory databases alive, since each connection would otherwise get its own database
+	db.SetMaxOpenConns(1)
+
+	return &sqlStore{db: db, dialect: sqliteDialect}, nil
+}
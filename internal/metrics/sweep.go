@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// HistorySweep calculates the historical metrics for increasing peak heights in a single pass over the blocks
+// It keeps an in memory window for each of the lookback windows, and advances them to each peak, reading only the blocks
+// added since the previous peak, instead of aggregating every window in the DB for every metric. The results are the
+// same as the Metrics methods with the same names
+type HistorySweep struct {
+	m *Metrics
+
+	// engines has an in memory window for each of the lookback windows
+	engines map[uint32]*nakamotoEngine
+
+	// peak is the height the engines were last advanced to, and distributions caches the distributions calculated
+	// for it, keyed by window and ignored addresses, so every threshold uses the same distribution
+	peak          uint32
+	advanced      bool
+	distributions map[string][]FarmerBlocks
+}
+
+// NewHistorySweep returns a sweep for the lookback windows. The peak heights must not decrease between calls
+func (m *Metrics) NewHistorySweep() *HistorySweep {
+	sweep := &HistorySweep{
+		m:             m,
+		engines:       map[uint32]*nakamotoEngine{},
+		distributions: map[string][]FarmerBlocks{},
+	}
+	for _, window := range m.LookbackWindows() {
+		sweep.engines[window] = newNakamotoEngine(window)
+	}
+
+	return sweep
+}
+
+// CalculateNakamotoForWindow calculates the NC for the given peak height, lookback window, and percentage
+// Windows that aren't one of the lookback windows, such as the windows for the lookback durations, are calculated in the
+// DB instead
+func (s *HistorySweep) CalculateNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	if _, ok := s.engines[lookbackWindow]; !ok {
+		return s.m.CalculateNakamotoForWindow(ctx, peakHeight, lookbackWindow, thresholdPercent, ignoreAddresses)
+	}
+
+	distribution, err := s.distribution(ctx, peakHeight, lookbackWindow, ignoreAddresses)
+	if err != nil {
+		return 0, err
+	}
+
+	return nakamotoCoefficient(distribution, lookbackWindow, thresholdPercent)
+}
+
+// CalculateEntityNakamotoForWindow calculates the NC for the lookback window ending at the peak height, with the
+// addresses grouped by entity
+func (s *HistorySweep) CalculateEntityNakamotoForWindow(ctx context.Context, peakHeight uint32, lookbackWindow uint32, thresholdPercent int, ignoreAddresses []string) (int, error) {
+	if _, ok := s.engines[lookbackWindow]; !ok {
+		return s.m.CalculateEntityNakamotoForWindow(ctx, peakHeight, lookbackWindow, thresholdPercent, ignoreAddresses)
+	}
+
+	distribution, err := s.distribution(ctx, peakHeight, lookbackWindow, ignoreAddresses)
+	if err != nil {
+		return 0, err
+	}
+
+	return nakamotoCoefficient(s.m.entities.groupByEntity(distribution), lookbackWindow, thresholdPercent)
+}
+
+// CalculateIndices calculates the decentralization indices for the lookback window ending at the peak height
+func (s *HistorySweep) CalculateIndices(ctx context.Context, peakHeight uint32, ignoreAddresses []string) (DecentralizationIndices, error) {
+	distribution, err := s.distribution(ctx, peakHeight, s.m.LookbackWindow(), ignoreAddresses)
+	if err != nil {
+		return DecentralizationIndices{}, err
+	}
+
+	return decentralizationIndices(distribution)
+}
+
+// distribution returns the distribution for the window ending at the peak height, advancing every window to the peak
+// the first time it is asked for
+func (s *HistorySweep) distribution(ctx context.Context, peakHeight uint32, window uint32, ignoreAddresses []string) ([]FarmerBlocks, error) {
+	if !s.advanced || peakHeight != s.peak {
+		for _, engine := range s.engines {
+			err := engine.advance(ctx, s.m.store, peakHeight)
+			if err != nil {
+				return nil, err
+			}
+		}
+		s.peak = peakHeight
+		s.advanced = true
+		s.distributions = map[string][]FarmerBlocks{}
+	}
+
+	key := fmt.Sprintf("%d:%s", window, strings.Join(ignoreAddresses, ","))
+	if distribution, ok := s.distributions[key]; ok {
+		return distribution, nil
+	}
+
+	distribution, err := s.engines[window].distribution(ignoreAddresses)
+	if err != nil {
+		return nil, err
+	}
+	s.distributions[key] = distribution
+
+	return distribution, nil
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// sweepFixtureBlocks is the number of blocks in the fixture dataset
+const sweepFixtureBlocks = 2000
+
+// newSweepFixture returns metrics backed by a SQLite DB with a fixture dataset of blocks
+// The farmers have a skewed distribution, so the NC varies along the chain, and heights 900 to 919 are missing, so
+// windows that overlap the gap don't have enough blocks
+func newSweepFixture(t *testing.T) *Metrics {
+	t.Helper()
+	ctx := context.Background()
+
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "fixture.sqlite"))
+	if err != nil {
+		t.Fatalf("error opening the fixture DB: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	err = store.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("error migrating the fixture DB: %s", err.Error())
+	}
+
+	random := rand.New(rand.NewSource(1))
+	var blocks []BlockRecord
+	for height := uint32(0); height < sweepFixtureBlocks; height++ {
+		if height >= 900 && height < 920 {
+			continue
+		}
+		// Squaring the random number favours the low numbered farmers, and the big farmer drops out half way through
+		farmer := int(random.Float64() * random.Float64() * 60)
+		if farmer == 0 && height > sweepFixtureBlocks/2 {
+			farmer = 60
+		}
+		blocks = append(blocks, BlockRecord{Height: height, FarmerAddress: fmt.Sprintf("xch1farmer%02d", farmer)})
+	}
+	err = store.ForNetwork("mainnet").SaveBlocks(ctx, blocks)
+	if err != nil {
+		t.Fatalf("error saving the fixture blocks: %s", err.Error())
+	}
+
+	entities := NewEntityRegistry()
+	for address, entity := range map[string]string{
+		"xch1farmer01": "Example Farms",
+		"xch1farmer02": "Example Farms",
+		"xch1farmer05": "Example Farms",
+		"xch1farmer03": "Other Farms",
+		"xch1farmer60": "Other Farms",
+	} {
+		err = entities.Set(address, entity)
+		if err != nil {
+			t.Fatalf("error setting the fixture entities: %s", err.Error())
+		}
+	}
+
+	m := &Metrics{
+		network:  Network{Name: "mainnet"},
+		store:    store.ForNetwork("mainnet"),
+		entities: entities,
+	}
+	m.settings.Store(&settings{
+		lookbackWindow:     200,
+		lookbackWindows:    []uint32{200, 50, 450},
+		nakamotoThresholds: []int{33, 50, 51, 67},
+	})
+
+	return m
+}
+
+// TestHistorySweepMatchesSQL checks that the single pass sweep calculates exactly the same metrics as the SQL path for
+// every window, threshold, and set of ignored addresses along the fixture chain, including the heights without enough
+// blocks
+func TestHistorySweepMatchesSQL(t *testing.T) {
+	ctx := context.Background()
+	m := newSweepFixture(t)
+	sweep := m.NewHistorySweep()
+
+	ignoreSets := [][]string{{}, {"xch1farmer00", "xch1farmer04"}}
+	for height := uint32(0); height < sweepFixtureBlocks+10; height += 7 {
+		for _, ignoreAddresses := range ignoreSets {
+			for _, window := range m.LookbackWindows() {
+				for _, threshold := range m.NakamotoThresholds() {
+					want, wantErr := m.CalculateNakamotoForWindow(ctx, height, window, threshold, ignoreAddresses)
+					got, gotErr := sweep.CalculateNakamotoForWindow(ctx, height, window, threshold, ignoreAddresses)
+					compareSweep(t, fmt.Sprintf("nc%d for window %d at %d ignoring %v", threshold, window, height, ignoreAddresses), want, wantErr, got, gotErr)
+				}
+			}
+
+			for _, threshold := range m.NakamotoThresholds() {
+				want, wantErr := m.CalculateEntityNakamotoForWindow(ctx, height, m.LookbackWindow(), threshold, ignoreAddresses)
+				got, gotErr := sweep.CalculateEntityNakamotoForWindow(ctx, height, m.LookbackWindow(), threshold, ignoreAddresses)
+				compareSweep(t, fmt.Sprintf("entity nc%d at %d ignoring %v", threshold, height, ignoreAddresses), want, wantErr, got, gotErr)
+			}
+
+			want, wantErr := m.CalculateIndices(ctx, height, ignoreAddresses)
+			got, gotErr := sweep.CalculateIndices(ctx, height, ignoreAddresses)
+			compareSweep(t, fmt.Sprintf("indices at %d ignoring %v", height, ignoreAddresses), want, wantErr, got, gotErr)
+		}
+	}
+}
+
+// compareSweep fails the test if the sweep result or error is different from the SQL path
+func compareSweep[T comparable](t *testing.T, name string, want T, wantErr error, got T, gotErr error) {
+	t.Helper()
+
+	if (wantErr == nil) != (gotErr == nil) {
+		t.Fatalf("%s: SQL error %v, sweep error %v", name, wantErr, gotErr)
+	}
+	if wantErr != nil && wantErr.Error() != gotErr.Error() {
+		t.Fatalf("%s: SQL error %q, sweep error %q", name, wantErr.Error(), gotErr.Error())
+	}
+	if want != got {
+		t.Fatalf("%s: SQL %v, sweep %v", name, want, got)
+	}
+}
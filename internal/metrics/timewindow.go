@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LookbackDuration is a lookback window defined by a length of time, instead of a number of blocks
+type LookbackDuration struct {
+	// Label is the duration as it was configured, such as 7d
+	Label    string
+	Duration time.Duration
+}
+
+// ParseLookbackDuration parses a duration such as 24h or 7d. In addition to the units time.ParseDuration supports,
+// d may be used for days
+func ParseLookbackDuration(value string) (LookbackDuration, error) {
+	var (
+		duration time.Duration
+		err      error
+	)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var count int
+		count, err = strconv.Atoi(days)
+		duration = time.Duration(count) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(value)
+	}
+	if err != nil || duration <= 0 {
+		return LookbackDuration{}, fmt.Errorf("invalid lookback duration %s. Must be a positive duration such as 24h or 7d", value)
+	}
+
+	return LookbackDuration{Label: value, Duration: duration}, nil
+}
+
+// lookbackDurations parses the configured lookback durations and removes duplicates
+func lookbackDurations(configured []string) ([]LookbackDuration, error) {
+	var durations []LookbackDuration
+	seen := map[string]bool{}
+	for _, value := range configured {
+		duration, err := ParseLookbackDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[duration.Label] {
+			continue
+		}
+		seen[duration.Label] = true
+		durations = append(durations, duration)
+	}
+
+	return durations, nil
+}
+
+// LookbackDurations returns the configured time based lookback windows
+func (m *Metrics) LookbackDurations() []LookbackDuration {
+	return m.config().lookbackDurations
+}
+
+// GetBlockTimestamp returns the timestamp stored for the block at the given height
+func (m *Metrics) GetBlockTimestamp(ctx context.Context, height uint32) (time.Time, error) {
+	timestamp, err := m.store.GetTimestamp(ctx, height)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !timestamp.Valid {
+		return time.Time{}, fmt.Errorf("block %d does not have a timestamp", height)
+	}
+
+	return timestamp.Time, nil
+}
+
+// GetHeightAtTime returns the height of the highest block with a timestamp at or before the given time
+func (m *Metrics) GetHeightAtTime(ctx context.Context, timestamp time.Time) (uint32, error) {
+	height, err := m.store.GetHeightAtTime(ctx, timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, notEnoughBlocksError{since: timestamp}
+	}
+	return height, err
+}
+
+// LookbackWindowSince returns the lookback window, in blocks, ending at peakHeight that covers every block with a
+// timestamp after since. The window can be passed to CalculateNakamotoForWindow
+// Returns an error if the DB doesn't have blocks from before since, since the window would be incomplete
+func (m *Metrics) LookbackWindowSince(ctx context.Context, peakHeight uint32, since time.Time) (uint32, error) {
+	startHeight, err := m.GetHeightAtTime(ctx, since)
+	if err != nil {
+		return 0, err
+	}
+	if startHeight >= peakHeight {
+		return 0, fmt.Errorf("no blocks between %s and height %d", since.UTC().Format(time.RFC3339), peakHeight)
+	}
+
+	return peakHeight - startHeight, nil
+}
+
+// refreshDurationNakamoto sets the NC gauges for every configured threshold over the blocks with timestamps within
+// the duration before the peak block. The distribution comes from the DB, since the number of blocks in the window
+// changes with the block times
+func (m *Metrics) refreshDurationNakamoto(ctx context.Context, settings *settings, peakHeight uint32, duration LookbackDuration) {
+	peakTime, err := m.GetBlockTimestamp(ctx, peakHeight)
+	if err != nil {
+		log.Errorf("Error getting the timestamp for the %s lookback window: %s\n", duration.Label, err.Error())
+		return
+	}
+
+	window, err := m.LookbackWindowSince(ctx, peakHeight, peakTime.Add(-duration.Duration))
+	if err != nil {
+		log.Errorf("Error resolving the %s lookback window: %s\n", duration.Label, err.Error())
+		return
+	}
+
+	distribution, err := m.GetFarmerDistribution(ctx, peakHeight, window, []string{})
+	if err != nil {
+		log.Errorf("Error getting the farmer distribution for the %s lookback window: %s\n", duration.Label, err.Error())
+		return
+	}
+	adjustedDistribution, err := m.GetFarmerDistribution(ctx, peakHeight, window, m.adjustedIgnoreAddresses(settings))
+	if err != nil {
+		log.Errorf("Error getting the adjusted farmer distribution for the %s lookback window: %s\n", duration.Label, err.Error())
+		return
+	}
+
+	for _, threshold := range settings.nakamotoThresholds {
+		thresholdLabel := strconv.Itoa(threshold)
+
+		nakamoto, err := nakamotoCoefficient(distribution, window, threshold)
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold nakamoto coefficient for the %s lookback window: %s\n", threshold, duration.Label, err.Error())
+			return
+		}
+
+		nakamotoAdj, err := nakamotoCoefficient(adjustedDistribution, window, threshold)
+		if err != nil {
+			log.Errorf("Error calculating %d%% threshold adjusted nakamoto coefficient for the %s lookback window: %s\n", threshold, duration.Label, err.Error())
+			return
+		}
+
+		m.prometheusMetrics.nakamotoCoefficient.WithLabelValues(thresholdLabel, duration.Label).Set(float64(nakamoto))
+		m.prometheusMetrics.nakamotoCoefficientAdjusted.WithLabelValues(thresholdLabel, duration.Label).Set(float64(nakamotoAdj))
+	}
+}
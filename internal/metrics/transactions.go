@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBlockCost is the most CLVM cost the transactions in a single block can use
+const maxBlockCost = 11_000_000_000
+
+// TransactionMetrics are the fee market measures for the transaction blocks in a window of blocks
+type TransactionMetrics struct {
+	// FeesPerBlock is the average fees, in mojos, per transaction block
+	FeesPerBlock float64
+
+	// Fullness is the average cost of the transaction blocks as a fraction of the max block cost. A proxy for how
+	// full the mempool is, since blocks are only full when there are more transactions waiting than fit
+	Fullness float64
+}
+
+// transactionWindows validates the configured transaction metric windows and removes duplicates
+func transactionWindows(configured []int) ([]uint32, error) {
+	var windows []uint32
+	seen := map[uint32]bool{}
+	for _, window := range configured {
+		if window <= 0 {
+			return nil, fmt.Errorf("invalid transaction window %d. Must be greater than 0", window)
+		}
+		if seen[uint32(window)] {
+			continue
+		}
+		seen[uint32(window)] = true
+		windows = append(windows, uint32(window))
+	}
+
+	return windows, nil
+}
+
+// TransactionWindows returns the configured windows, in blocks, the transaction metrics are calculated for
+func (m *Metrics) TransactionWindows() []uint32 {
+	return m.config().transactionWindows
+}
+
+// CalculateTransactionMetrics calculates the fee market metrics for the window of blocks ending at the peak height
+// Only transaction blocks saved with the transactions info are included, so re-ingest older blocks first
+func (m *Metrics) CalculateTransactionMetrics(ctx context.Context, peakHeight uint32, window uint32) (TransactionMetrics, error) {
+	if peakHeight < window {
+		return TransactionMetrics{}, notEnoughBlocksError{lookbackWindow: window}
+	}
+
+	totals, err := m.store.GetTransactionTotals(ctx, peakHeight-window, peakHeight)
+	if err != nil {
+		return TransactionMetrics{}, err
+	}
+	if totals.TransactionBlocks == 0 {
+		return TransactionMetrics{}, fmt.Errorf("no transaction blocks with transactions info in the %d block window", window)
+	}
+
+	return TransactionMetrics{
+		FeesPerBlock: totals.Fees / float64(totals.TransactionBlocks),
+		Fullness:     totals.Cost / (float64(totals.TransactionBlocks) * maxBlockCost),
+	}, nil
+}
+
+// CalculateTransactionsPerSecond calculates the number of coins spent per second over the window of blocks ending at
+// the peak height
+// Only transaction blocks with their coins counted have the removals, so when some of the window doesn't, the rate is
+// calculated over just the counted blocks instead, such as the peaks received since blocks were gap filled without
+// count-coins. It's an error if the counted blocks aren't a single run, since the time between them is unknown
+func (m *Metrics) CalculateTransactionsPerSecond(ctx context.Context, peakHeight uint32, window uint32) (float64, error) {
+	if peakHeight < window {
+		return 0, notEnoughBlocksError{lookbackWindow: window}
+	}
+
+	totals, err := m.store.GetTransactionTotals(ctx, peakHeight-window, peakHeight)
+	if err != nil {
+		return 0, err
+	}
+	if totals.CoinBlocks == 0 {
+		return 0, fmt.Errorf("no transaction blocks with their coins counted in the %d block window", window)
+	}
+
+	// The coins spent by a transaction block were spent since the previous transaction block, which is the timestamp
+	// the block below it has, so the range starts at the block below the first one counted
+	startHeight, endHeight := peakHeight-window, peakHeight
+	if totals.CoinBlocks < totals.TransactionBlocks {
+		startHeight, endHeight = totals.FirstCoinHeight-1, totals.LastCoinHeight
+		counted, err := m.store.GetTransactionTotals(ctx, startHeight, endHeight)
+		if err != nil {
+			return 0, err
+		}
+		if counted.CoinBlocks != counted.TransactionBlocks {
+			return 0, fmt.Errorf("only %d of the %d transaction blocks in the %d block window have their coins counted, and they aren't a single run. Re-ingest with count-coins to count them",
+				totals.CoinBlocks, totals.TransactionBlocks, window)
+		}
+	}
+
+	startTime, err := m.GetBlockTimestamp(ctx, startHeight)
+	if err != nil {
+		return 0, err
+	}
+	endTime, err := m.GetBlockTimestamp(ctx, endHeight)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := endTime.Sub(startTime).Seconds()
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("no time elapsed between blocks %d and %d", startHeight, endHeight)
+	}
+
+	return totals.Removals / elapsed, nil
+}
+
+// refreshTransactionMetrics sets the fee market gauges for every configured transaction window
+func (m *Metrics) refreshTransactionMetrics(ctx context.Context, settings *settings, peakHeight uint32) {
+	for _, window := range settings.transactionWindows {
+		metrics, err := m.CalculateTransactionMetrics(ctx, peakHeight, window)
+		if err != nil {
+			log.Errorf("Error calculating the transaction metrics for the %d block window: %s\n", window, err.Error())
+			continue
+		}
+
+		windowLabel := strconv.FormatUint(uint64(window), 10)
+		m.prometheusMetrics.feesPerBlock.WithLabelValues(windowLabel).Set(metrics.FeesPerBlock)
+		m.prometheusMetrics.blockFullness.WithLabelValues(windowLabel).Set(metrics.Fullness)
+
+		transactionsPerSecond, err := m.CalculateTransactionsPerSecond(ctx, peakHeight, window)
+		if err != nil {
+			log.Errorf("Error calculating the transactions per second for the %d block window: %s\n", window, err.Error())
+			continue
+		}
+		m.prometheusMetrics.transactionsPerSecond.WithLabelValues(windowLabel).Set(transactionsPerSecond)
+	}
+}
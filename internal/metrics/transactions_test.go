@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestCalculateTransactionsPerSecond checks the rate is only taken over the blocks with their coins counted
+func TestCalculateTransactionsPerSecond(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// saveWindow saves blocks 0 to 100, a transaction block every 10 seconds spending 5 coins, with the coins counted
+	// for the heights counted returns true for
+	saveWindow := func(t *testing.T, counted func(height uint32) bool) *Metrics {
+		t.Helper()
+		m := &Metrics{network: Network{Name: "mainnet"}, store: newTestStore(t)}
+		var blocks []BlockRecord
+		for height := uint32(0); height <= 100; height++ {
+			block := txBlock(height, "", 5, 5, counted(height))
+			block.Timestamp = sql.NullTime{Time: start.Add(time.Duration(height) * 10 * time.Second), Valid: true}
+			blocks = append(blocks, block)
+		}
+		err := m.store.SaveBlocks(ctx, blocks)
+		if err != nil {
+			t.Fatalf("error saving blocks: %s", err.Error())
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		counted func(height uint32) bool
+		wantErr bool
+	}{
+		{name: "fully counted", counted: func(height uint32) bool { return true }},
+		{name: "counted since a gap fill", counted: func(height uint32) bool { return height > 60 }},
+		{name: "counted before a gap fill", counted: func(height uint32) bool { return height <= 80 }},
+		{name: "not a single run", counted: func(height uint32) bool { return height%2 == 0 }, wantErr: true},
+		{name: "not counted", counted: func(height uint32) bool { return false }, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := saveWindow(t, test.counted)
+			tps, err := m.CalculateTransactionsPerSecond(ctx, 100, 50)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %f", tps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error calculating the rate: %s", err.Error())
+			}
+			// 5 coins every 10 seconds, however much of the window is counted
+			if math.Abs(tps-0.5) > 1e-9 {
+				t.Fatalf("got %f transactions per second, want 0.5", tps)
+			}
+		})
+	}
+}
@@ -1,59 +1,135 @@
 package metrics
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/chia-network/go-chia-libs/pkg/types"
 	log "github.com/sirupsen/logrus"
 )
 
-// OpenWebsocket sets up the RPC client and subscribes to relevant topics
+// OpenWebsocket sets up the RPC clients and subscribes to relevant topics on every full node
+// Nodes that are already subscribed are skipped, so this can be called again to retry the nodes that failed
 func (m *Metrics) OpenWebsocket() error {
-	err := m.websocketClient.SubscribeSelf()
+	var errs []error
+	for _, node := range m.nodes {
+		err := m.openNodeWebsocket(node)
+		if err != nil {
+			m.setNodeHealthy(node, false)
+			errs = append(errs, fmt.Errorf("error subscribing to %s: %w", node.hostname, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Metrics) openNodeWebsocket(node *fullNode) error {
+	if node.subscribed {
+		return nil
+	}
+	if node.websocketClient == nil {
+		return fmt.Errorf("no websocket client in %s ingest mode", IngestModePoll)
+	}
+
+	err := node.websocketClient.SubscribeSelf()
 	if err != nil {
 		return err
 	}
 
-	err = m.websocketClient.Subscribe("metrics")
+	err = node.websocketClient.Subscribe("metrics")
 	if err != nil {
 		return err
 	}
 
-	_, err = m.websocketClient.AddHandler(m.websocketReceive)
+	node.handlerID, err = node.websocketClient.AddHandler(func(resp *types.WebsocketResponse, err error) {
+		m.websocketReceive(node, resp, err)
+	})
 	if err != nil {
 		return err
 	}
 
-	m.websocketClient.AddDisconnectHandler(m.disconnectHandler)
-	m.websocketClient.AddReconnectHandler(m.reconnectHandler)
+	node.websocketClient.AddDisconnectHandler(func() {
+		m.disconnectHandler(node)
+	})
+	node.websocketClient.AddReconnectHandler(func() {
+		m.reconnectHandler(node)
+	})
+	node.subscribed = true
+	m.setNodeHealthy(node, true)
 
 	return nil
 }
 
-// CloseWebsocket closes the websocket connection
+// CloseWebsocket closes the websocket connection to every full node
 func (m *Metrics) CloseWebsocket() error {
-	// @TODO reenable once fixed in the upstream dep
-	//return m.websocketClient.DaemonService.CloseConnection()
-	return nil
+	var errs []error
+	for _, node := range m.nodes {
+		if node.websocketClient == nil {
+			continue
+		}
+		err := node.websocketClient.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func (m *Metrics) websocketReceive(resp *types.WebsocketResponse, err error) {
+// stopReceiving stops handling websocket events, so no new work starts during shutdown
+func (m *Metrics) stopReceiving() {
+	m.stopLock.Lock()
+	defer m.stopLock.Unlock()
+
+	m.stopping = true
+	for _, node := range m.nodes {
+		if node.subscribed {
+			node.websocketClient.RemoveHandler(node.handlerID)
+		}
+	}
+}
+
+// startWork registers work started by a websocket event, so shutdown can wait for it to finish
+// Returns false if we are shutting down, and the work should not start
+func (m *Metrics) startWork() bool {
+	m.stopLock.Lock()
+	defer m.stopLock.Unlock()
+
+	if m.stopping {
+		return false
+	}
+	m.inFlight.Add(1)
+
+	return true
+}
+
+func (m *Metrics) websocketReceive(node *fullNode, resp *types.WebsocketResponse, err error) {
 	if err != nil {
-		log.Errorf("Websocket received err: %s\n", err.Error())
+		log.Errorf("Websocket received err from %s: %s\n", node.hostname, err.Error())
+		return
+	}
+
+	if !m.startWork() {
+		log.Debugf("Shutting down. Ignoring %s %s\n", resp.Origin, resp.Command)
 		return
 	}
+	defer m.inFlight.Done()
 
 	log.Printf("recv: %s %s\n", resp.Origin, resp.Command)
 	log.Debugf("origin: %s command: %s destination: %s data: %s\n", resp.Origin, resp.Command, resp.Destination, string(resp.Data))
 
 	switch resp.Command {
 	case "block":
-		m.receiveBlock(resp)
+		m.receiveBlock(m.workCtx, node, resp)
 	}
 }
 
-func (m *Metrics) disconnectHandler() {
-	log.Debug("Calling disconnect handlers")
+func (m *Metrics) disconnectHandler(node *fullNode) {
+	log.Debugf("Calling disconnect handlers for %s\n", node.hostname)
+	m.setNodeHealthy(node, false)
 }
 
-func (m *Metrics) reconnectHandler() {
-	log.Debug("Calling reconnect handlers")
+func (m *Metrics) reconnectHandler(node *fullNode) {
+	log.Debugf("Calling reconnect handlers for %s\n", node.hostname)
+	m.setNodeHealthy(node, true)
 }
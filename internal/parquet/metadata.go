@@ -0,0 +1,471 @@
+package parquet
+
+// The parts of the Parquet format definition (parquet.thrift) that are read and written. Fields that aren't needed are
+// skipped when reading, and left out when writing
+
+// Physical types
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDouble            = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// Field repetition types
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	repetitionRepeated = 2
+)
+
+// Converted types, the older way of annotating the physical types, which readers that predate logical types use
+const (
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+	convertedUint8           = 11
+	convertedUint16          = 12
+	convertedUint32          = 13
+	convertedUint64          = 14
+)
+
+// Logical types, the ids of the LogicalType union fields
+const (
+	logicalString    = 1
+	logicalTimestamp = 8
+	logicalInteger   = 10
+)
+
+// Time units, the ids of the TimeUnit union fields
+const (
+	unitMillis = 1
+	unitMicros = 2
+	unitNanos  = 3
+)
+
+// Encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// Compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+type fileMetaData struct {
+	schema    []schemaElement
+	numRows   int64
+	rowGroups []rowGroup
+	keyValues []keyValue
+	createdBy string
+}
+
+type schemaElement struct {
+	typ           int32
+	hasType       bool
+	repetition    int32
+	name          string
+	numChildren   int32
+	convertedType int32
+	hasConverted  bool
+	logical       logicalType
+}
+
+// logicalType is the LogicalType union, with kind set to the id of the field that is set, or 0 if none is
+type logicalType struct {
+	kind          int16
+	timestampUTC  bool
+	timestampUnit int16
+	bitWidth      int8
+	signed        bool
+}
+
+type rowGroup struct {
+	columns       []columnChunk
+	totalByteSize int64
+	numRows       int64
+}
+
+// columnChunk has the ColumnChunk fields along with its ColumnMetaData
+type columnChunk struct {
+	typ                   int32
+	encodings             []int32
+	path                  []string
+	codec                 int32
+	numValues             int64
+	totalUncompressedSize int64
+	totalCompressedSize   int64
+	dataPageOffset        int64
+	dictionaryPageOffset  int64
+	hasDictionaryPage     bool
+}
+
+type keyValue struct {
+	key   string
+	value string
+}
+
+// pageHeader has the PageHeader fields along with the fields of whichever page type header it has
+type pageHeader struct {
+	typ              int32
+	uncompressedSize int32
+	compressedSize   int32
+
+	// numValues and encoding are from the data, data v2, or dictionary page header
+	numValues int32
+	encoding  int32
+
+	// definitionEncoding is from the data page header
+	definitionEncoding int32
+
+	// numNulls, the levels lengths, and compressed are from the data v2 page header
+	numNulls          int32
+	definitionLength  int32
+	repetitionLength  int32
+	compressed        bool
+	hasDataHeader     bool
+	hasDictionaryInfo bool
+}
+
+func (m *fileMetaData) write(w *thriftWriter) {
+	w.structBegin()
+	w.fieldI32(1, 1)
+	w.fieldList(2, thriftStruct, len(m.schema))
+	for _, element := range m.schema {
+		element.write(w)
+	}
+	w.fieldI64(3, m.numRows)
+	w.fieldList(4, thriftStruct, len(m.rowGroups))
+	for _, group := range m.rowGroups {
+		group.write(w)
+	}
+	if len(m.keyValues) > 0 {
+		w.fieldList(5, thriftStruct, len(m.keyValues))
+		for _, kv := range m.keyValues {
+			w.structBegin()
+			w.fieldString(1, kv.key)
+			w.fieldString(2, kv.value)
+			w.structEnd()
+		}
+	}
+	w.fieldString(6, m.createdBy)
+	w.structEnd()
+}
+
+func (e *schemaElement) write(w *thriftWriter) {
+	w.structBegin()
+	if e.hasType {
+		w.fieldI32(1, e.typ)
+		w.fieldI32(3, e.repetition)
+	}
+	w.fieldString(4, e.name)
+	if e.numChildren > 0 {
+		w.fieldI32(5, e.numChildren)
+	}
+	if e.hasConverted {
+		w.fieldI32(6, e.convertedType)
+	}
+	if e.logical.kind != 0 {
+		w.fieldStruct(10)
+		w.fieldStruct(e.logical.kind)
+		switch e.logical.kind {
+		case logicalTimestamp:
+			w.fieldBool(1, e.logical.timestampUTC)
+			w.fieldStruct(2)
+			w.fieldStruct(e.logical.timestampUnit)
+			w.structEnd()
+			w.structEnd()
+		case logicalInteger:
+			w.fieldByte(1, e.logical.bitWidth)
+			w.fieldBool(2, e.logical.signed)
+		}
+		w.structEnd()
+		w.structEnd()
+	}
+	w.structEnd()
+}
+
+func (g *rowGroup) write(w *thriftWriter) {
+	w.structBegin()
+	w.fieldList(1, thriftStruct, len(g.columns))
+	for _, column := range g.columns {
+		column.write(w)
+	}
+	w.fieldI64(2, g.totalByteSize)
+	w.fieldI64(3, g.numRows)
+	w.structEnd()
+}
+
+func (c *columnChunk) write(w *thriftWriter) {
+	w.structBegin()
+	w.fieldI64(2, c.dataPageOffset)
+	w.fieldStruct(3)
+	w.fieldI32(1, c.typ)
+	w.fieldList(2, thriftI32, len(c.encodings))
+	for _, encoding := range c.encodings {
+		w.varint(int64(encoding))
+	}
+	w.fieldList(3, thriftBinary, len(c.path))
+	for _, name := range c.path {
+		w.string(name)
+	}
+	w.fieldI32(4, c.codec)
+	w.fieldI64(5, c.numValues)
+	w.fieldI64(6, c.totalUncompressedSize)
+	w.fieldI64(7, c.totalCompressedSize)
+	w.fieldI64(9, c.dataPageOffset)
+	w.structEnd()
+	w.structEnd()
+}
+
+// write writes the header of a v1 data page
+func (h *pageHeader) write(w *thriftWriter) {
+	w.structBegin()
+	w.fieldI32(1, h.typ)
+	w.fieldI32(2, h.uncompressedSize)
+	w.fieldI32(3, h.compressedSize)
+	w.fieldStruct(5)
+	w.fieldI32(1, h.numValues)
+	w.fieldI32(2, h.encoding)
+	w.fieldI32(3, h.definitionEncoding)
+	w.fieldI32(4, encodingRLE)
+	w.structEnd()
+	w.structEnd()
+}
+
+func readFileMetaData(r *thriftReader) fileMetaData {
+	var m fileMetaData
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 2 && typ == thriftList:
+			r.readList(func(typ byte) {
+				m.schema = append(m.schema, readSchemaElement(r))
+			})
+		case id == 3 && typ == thriftI64:
+			m.numRows = r.i64()
+		case id == 4 && typ == thriftList:
+			r.readList(func(typ byte) {
+				m.rowGroups = append(m.rowGroups, readRowGroup(r))
+			})
+		case id == 5 && typ == thriftList:
+			r.readList(func(typ byte) {
+				var kv keyValue
+				r.readStruct(func(id int16, typ byte) {
+					switch {
+					case id == 1 && typ == thriftBinary:
+						kv.key = r.string()
+					case id == 2 && typ == thriftBinary:
+						kv.value = r.string()
+					default:
+						r.skip(typ)
+					}
+				})
+				m.keyValues = append(m.keyValues, kv)
+			})
+		case id == 6 && typ == thriftBinary:
+			m.createdBy = r.string()
+		default:
+			r.skip(typ)
+		}
+	})
+	return m
+}
+
+func readSchemaElement(r *thriftReader) schemaElement {
+	var e schemaElement
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftI32:
+			e.typ = r.i32()
+			e.hasType = true
+		case id == 3 && typ == thriftI32:
+			e.repetition = r.i32()
+		case id == 4 && typ == thriftBinary:
+			e.name = r.string()
+		case id == 5 && typ == thriftI32:
+			e.numChildren = r.i32()
+		case id == 6 && typ == thriftI32:
+			e.convertedType = r.i32()
+			e.hasConverted = true
+		case id == 10 && typ == thriftStruct:
+			e.logical = readLogicalType(r)
+		default:
+			r.skip(typ)
+		}
+	})
+	return e
+}
+
+func readLogicalType(r *thriftReader) logicalType {
+	var l logicalType
+	r.readStruct(func(kind int16, typ byte) {
+		if typ != thriftStruct {
+			r.skip(typ)
+			return
+		}
+		l.kind = kind
+		r.readStruct(func(id int16, typ byte) {
+			switch {
+			case kind == logicalTimestamp && id == 1:
+				l.timestampUTC = r.boolValue(typ)
+			case kind == logicalTimestamp && id == 2 && typ == thriftStruct:
+				r.readStruct(func(unit int16, typ byte) {
+					l.timestampUnit = unit
+					r.skip(typ)
+				})
+			case kind == logicalInteger && id == 1 && typ == thriftByte:
+				l.bitWidth = int8(r.byte())
+			case kind == logicalInteger && id == 2:
+				l.signed = r.boolValue(typ)
+			default:
+				r.skip(typ)
+			}
+		})
+	})
+	return l
+}
+
+func readRowGroup(r *thriftReader) rowGroup {
+	var g rowGroup
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftList:
+			r.readList(func(typ byte) {
+				g.columns = append(g.columns, readColumnChunk(r))
+			})
+		case id == 2 && typ == thriftI64:
+			g.totalByteSize = r.i64()
+		case id == 3 && typ == thriftI64:
+			g.numRows = r.i64()
+		default:
+			r.skip(typ)
+		}
+	})
+	return g
+}
+
+func readColumnChunk(r *thriftReader) columnChunk {
+	var c columnChunk
+	r.readStruct(func(id int16, typ byte) {
+		if id == 1 && typ == thriftBinary {
+			r.string()
+			r.fail("column chunks in other files are not supported")
+			return
+		}
+		if id != 3 || typ != thriftStruct {
+			r.skip(typ)
+			return
+		}
+		r.readStruct(func(id int16, typ byte) {
+			switch {
+			case id == 1 && typ == thriftI32:
+				c.typ = r.i32()
+			case id == 2 && typ == thriftList:
+				r.readList(func(typ byte) {
+					c.encodings = append(c.encodings, r.i32())
+				})
+			case id == 3 && typ == thriftList:
+				r.readList(func(typ byte) {
+					c.path = append(c.path, r.string())
+				})
+			case id == 4 && typ == thriftI32:
+				c.codec = r.i32()
+			case id == 5 && typ == thriftI64:
+				c.numValues = r.i64()
+			case id == 6 && typ == thriftI64:
+				c.totalUncompressedSize = r.i64()
+			case id == 7 && typ == thriftI64:
+				c.totalCompressedSize = r.i64()
+			case id == 9 && typ == thriftI64:
+				c.dataPageOffset = r.i64()
+			case id == 11 && typ == thriftI64:
+				c.dictionaryPageOffset = r.i64()
+				c.hasDictionaryPage = true
+			default:
+				r.skip(typ)
+			}
+		})
+	})
+	return c
+}
+
+func readPageHeader(r *thriftReader) pageHeader {
+	h := pageHeader{compressed: true}
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftI32:
+			h.typ = r.i32()
+		case id == 2 && typ == thriftI32:
+			h.uncompressedSize = r.i32()
+		case id == 3 && typ == thriftI32:
+			h.compressedSize = r.i32()
+		case id == 5 && typ == thriftStruct:
+			h.hasDataHeader = true
+			r.readStruct(func(id int16, typ byte) {
+				switch {
+				case id == 1 && typ == thriftI32:
+					h.numValues = r.i32()
+				case id == 2 && typ == thriftI32:
+					h.encoding = r.i32()
+				case id == 3 && typ == thriftI32:
+					h.definitionEncoding = r.i32()
+				default:
+					r.skip(typ)
+				}
+			})
+		case id == 7 && typ == thriftStruct:
+			h.hasDictionaryInfo = true
+			r.readStruct(func(id int16, typ byte) {
+				switch {
+				case id == 1 && typ == thriftI32:
+					h.numValues = r.i32()
+				case id == 2 && typ == thriftI32:
+					h.encoding = r.i32()
+				default:
+					r.skip(typ)
+				}
+			})
+		case id == 8 && typ == thriftStruct:
+			h.hasDataHeader = true
+			r.readStruct(func(id int16, typ byte) {
+				switch {
+				case id == 1 && typ == thriftI32:
+					h.numValues = r.i32()
+				case id == 2 && typ == thriftI32:
+					h.numNulls = r.i32()
+				case id == 4 && typ == thriftI32:
+					h.encoding = r.i32()
+				case id == 5 && typ == thriftI32:
+					h.definitionLength = r.i32()
+				case id == 6 && typ == thriftI32:
+					h.repetitionLength = r.i32()
+				case id == 7:
+					h.compressed = r.boolValue(typ)
+				default:
+					r.skip(typ)
+				}
+			})
+		default:
+			r.skip(typ)
+		}
+	})
+	return h
+}
@@ -0,0 +1,180 @@
+// Package parquet reads and writes flat Parquet files, where every column is a required or optional value of one of the
+// Kinds, with string key value metadata
+// Files are written with a PLAIN encoded, zstd compressed page per column for every few thousand rows. Files from other
+// writers can be read as long as their columns are flat and have one of the supported types
+package parquet
+
+import (
+	"fmt"
+	"time"
+)
+
+// magic is at the start and end of every Parquet file
+const magic = "PAR1"
+
+// Magic returns whether the data is the start of a Parquet file
+func Magic(data []byte) bool {
+	return len(data) >= len(magic) && string(data[:len(magic)]) == magic
+}
+
+// Kind is the type of the values of a column
+type Kind int
+
+// The kinds of column, with the Go type of their values
+const (
+	Boolean   Kind = iota // bool
+	Int32                 // int32
+	Int64                 // int64
+	Uint8                 // uint8
+	Uint32                // uint32
+	Uint64                // uint64
+	Double                // float64
+	String                // string
+	Timestamp             // time.Time, stored in microseconds
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Boolean:
+		return "boolean"
+	case Int32:
+		return "int32"
+	case Int64:
+		return "int64"
+	case Uint8:
+		return "uint8"
+	case Uint32:
+		return "uint32"
+	case Uint64:
+		return "uint64"
+	case Double:
+		return "double"
+	case String:
+		return "string"
+	case Timestamp:
+		return "timestamp"
+	default:
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+}
+
+// Column is a column of a file. Values of optional columns can be nil
+type Column struct {
+	Name     string
+	Kind     Kind
+	Optional bool
+}
+
+// schemaElement returns the schema element the column is written with
+func (c Column) schemaElement() (schemaElement, error) {
+	element := schemaElement{name: c.Name, hasType: true, repetition: repetitionRequired}
+	if c.Optional {
+		element.repetition = repetitionOptional
+	}
+
+	switch c.Kind {
+	case Boolean:
+		element.typ = typeBoolean
+	case Int32:
+		element.typ = typeInt32
+	case Int64:
+		element.typ = typeInt64
+	case Uint8:
+		element.typ = typeInt32
+		element.setConverted(convertedUint8)
+		element.logical = logicalType{kind: logicalInteger, bitWidth: 8}
+	case Uint32:
+		element.typ = typeInt32
+		element.setConverted(convertedUint32)
+		element.logical = logicalType{kind: logicalInteger, bitWidth: 32}
+	case Uint64:
+		element.typ = typeInt64
+		element.setConverted(convertedUint64)
+		element.logical = logicalType{kind: logicalInteger, bitWidth: 64}
+	case Double:
+		element.typ = typeDouble
+	case String:
+		element.typ = typeByteArray
+		element.setConverted(convertedUTF8)
+		element.logical = logicalType{kind: logicalString}
+	case Timestamp:
+		element.typ = typeInt64
+		element.setConverted(convertedTimestampMicros)
+		element.logical = logicalType{kind: logicalTimestamp, timestampUTC: true, timestampUnit: unitMicros}
+	default:
+		return schemaElement{}, fmt.Errorf("column %s has unknown kind %s", c.Name, c.Kind)
+	}
+
+	return element, nil
+}
+
+func (e *schemaElement) setConverted(converted int32) {
+	e.convertedType = converted
+	e.hasConverted = true
+}
+
+// columnFromSchema returns the column for a leaf of the schema read from a file, along with the unit its timestamps are
+// stored in
+func columnFromSchema(element schemaElement) (Column, time.Duration, error) {
+	column := Column{Name: element.name}
+	switch element.repetition {
+	case repetitionRequired:
+	case repetitionOptional:
+		column.Optional = true
+	default:
+		return Column{}, 0, fmt.Errorf("column %s is repeated, which isn't supported", element.name)
+	}
+
+	unsigned := element.logical.kind == logicalInteger && !element.logical.signed
+	converted := int32(-1)
+	if element.hasConverted {
+		converted = element.convertedType
+	}
+
+	switch element.typ {
+	case typeBoolean:
+		column.Kind = Boolean
+	case typeInt32:
+		switch {
+		case converted == convertedUint8 || unsigned && element.logical.bitWidth == 8:
+			column.Kind = Uint8
+		case converted == convertedUint16 || converted == convertedUint32 || unsigned:
+			column.Kind = Uint32
+		default:
+			column.Kind = Int32
+		}
+	case typeInt64:
+		switch {
+		case element.logical.kind == logicalTimestamp:
+			column.Kind = Timestamp
+			switch element.logical.timestampUnit {
+			case unitMillis:
+				return column, time.Millisecond, nil
+			case unitMicros:
+				return column, time.Microsecond, nil
+			case unitNanos:
+				return column, time.Nanosecond, nil
+			default:
+				return Column{}, 0, fmt.Errorf("column %s has an unknown timestamp unit", element.name)
+			}
+		case converted == convertedTimestampMillis:
+			column.Kind = Timestamp
+			return column, time.Millisecond, nil
+		case converted == convertedTimestampMicros:
+			column.Kind = Timestamp
+			return column, time.Microsecond, nil
+		case converted == convertedUint64 || unsigned:
+			column.Kind = Uint64
+		default:
+			column.Kind = Int64
+		}
+	case typeFloat, typeDouble:
+		column.Kind = Double
+	case typeByteArray:
+		column.Kind = String
+	default:
+		return Column{}, 0, fmt.Errorf("column %s has physical type %d, which isn't supported", element.name, element.typ)
+	}
+
+	return column, 0, nil
+}
@@ -0,0 +1,361 @@
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// allKinds has a required and an optional column of every kind
+var allKinds = func() []Column {
+	var columns []Column
+	for _, kind := range []Kind{Boolean, Int32, Int64, Uint8, Uint32, Uint64, Double, String, Timestamp} {
+		columns = append(columns,
+			Column{Name: kind.String(), Kind: kind},
+			Column{Name: "optional_" + kind.String(), Kind: kind, Optional: true},
+		)
+	}
+	return columns
+}()
+
+// kindValue returns the value of the kind for row i, using the full range of the kind
+func kindValue(kind Kind, i int) any {
+	switch kind {
+	case Boolean:
+		return i%2 == 0
+	case Int32:
+		return int32(i) - 40000
+	case Int64:
+		return int64(i) * -1_000_000_000_000
+	case Uint8:
+		return uint8(i)
+	case Uint32:
+		return math.MaxUint32 - uint32(i)
+	case Uint64:
+		return math.MaxUint64 - uint64(i)
+	case Double:
+		return float64(i) / 3
+	case String:
+		if i%10 == 0 {
+			return ""
+		}
+		return fmt.Sprintf("value %d", i)
+	case Timestamp:
+		return time.UnixMicro(1_700_000_000_000_000 + int64(i)).UTC()
+	}
+	return nil
+}
+
+// allKindsRow returns row i for the allKinds columns. Optional values are nil for every third row, and for a run of
+// rows longer than a page
+func allKindsRow(i int) []any {
+	row := make([]any, len(allKinds))
+	for j, column := range allKinds {
+		if column.Optional && (i%3 == 1 || i >= 10000 && i < 20000) {
+			continue
+		}
+		row[j] = kindValue(column.Kind, i)
+	}
+	return row
+}
+
+// equalValue returns whether the values read and written are the same, comparing times by instant
+func equalValue(got any, want any) bool {
+	if wantTime, ok := want.(time.Time); ok {
+		gotTime, ok := got.(time.Time)
+		return ok && gotTime.Equal(wantTime)
+	}
+	return got == want
+}
+
+// checkRow fails the test if the row read doesn't have the expected values
+func checkRow(t *testing.T, i int, got []any, want []any, columns []Column) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("row %d has %d values, want %d", i, len(got), len(want))
+	}
+	for j := range want {
+		if !equalValue(got[j], want[j]) {
+			t.Fatalf("row %d column %s is %#v, want %#v", i, columns[j].Name, got[j], want[j])
+		}
+	}
+}
+
+// TestRoundTrip checks the rows and metadata written are read back, for every kind, with enough rows for several pages
+// and row groups
+func TestRoundTrip(t *testing.T) {
+	metadata := map[string]string{"format": "test", "empty": ""}
+	rows := pageRows*groupPages + pageRows + 3
+
+	var file bytes.Buffer
+	writer, err := NewWriter(&file, allKinds, metadata)
+	if err != nil {
+		t.Fatalf("error creating the writer: %s", err.Error())
+	}
+	for i := 0; i < rows; i++ {
+		err = writer.Write(allKindsRow(i))
+		if err != nil {
+			t.Fatalf("error writing row %d: %s", i, err.Error())
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("error closing the writer: %s", err.Error())
+	}
+
+	reader, err := NewReader(bytes.NewReader(file.Bytes()), int64(file.Len()))
+	if err != nil {
+		t.Fatalf("error opening the reader: %s", err.Error())
+	}
+	defer reader.Close()
+
+	if len(reader.groups) != 2 {
+		t.Fatalf("file has %d row groups, want 2", len(reader.groups))
+	}
+	if reader.NumRows() != int64(rows) {
+		t.Fatalf("file has %d rows, want %d", reader.NumRows(), rows)
+	}
+	if fmt.Sprint(reader.Columns()) != fmt.Sprint(allKinds) {
+		t.Fatalf("columns are %v, want %v", reader.Columns(), allKinds)
+	}
+	if fmt.Sprint(reader.Metadata()) != fmt.Sprint(metadata) {
+		t.Fatalf("metadata is %v, want %v", reader.Metadata(), metadata)
+	}
+
+	for i := 0; i < rows; i++ {
+		row, err := reader.Read()
+		if err != nil {
+			t.Fatalf("error reading row %d: %s", i, err.Error())
+		}
+		checkRow(t, i, row, allKindsRow(i), allKinds)
+	}
+	_, err = reader.Read()
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after the last row, got %v", err)
+	}
+}
+
+// TestEmptyFile checks a file without any rows has its columns and no rows
+func TestEmptyFile(t *testing.T) {
+	var file bytes.Buffer
+	writer, err := NewWriter(&file, allKinds, nil)
+	if err != nil {
+		t.Fatalf("error creating the writer: %s", err.Error())
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("error closing the writer: %s", err.Error())
+	}
+
+	reader, err := NewReader(bytes.NewReader(file.Bytes()), int64(file.Len()))
+	if err != nil {
+		t.Fatalf("error opening the reader: %s", err.Error())
+	}
+	defer reader.Close()
+
+	if reader.NumRows() != 0 || len(reader.Metadata()) != 0 || len(reader.Columns()) != len(allKinds) {
+		t.Fatalf("got %d rows, metadata %v and %d columns, want an empty file with %d columns", reader.NumRows(), reader.Metadata(), len(reader.Columns()), len(allKinds))
+	}
+	_, err = reader.Read()
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+// TestWriteErrors checks rows that don't match the columns are refused
+func TestWriteErrors(t *testing.T) {
+	_, err := NewWriter(io.Discard, nil, nil)
+	if err == nil {
+		t.Fatalf("expected an error for a file without columns")
+	}
+	_, err = NewWriter(io.Discard, []Column{{Name: "a", Kind: Int32}, {Name: "a", Kind: Int64}}, nil)
+	if err == nil {
+		t.Fatalf("expected an error for repeated column names")
+	}
+	_, err = NewWriter(io.Discard, []Column{{Name: "a", Kind: Kind(100)}}, nil)
+	if err == nil {
+		t.Fatalf("expected an error for an unknown kind")
+	}
+
+	writer, err := NewWriter(io.Discard, []Column{{Name: "required", Kind: Uint32}, {Name: "optional", Kind: String, Optional: true}}, nil)
+	if err != nil {
+		t.Fatalf("error creating the writer: %s", err.Error())
+	}
+	for _, row := range [][]any{
+		{uint32(1)},
+		{nil, "a"},
+		{int32(1), "a"},
+		{uint32(1), 1},
+	} {
+		err = writer.Write(row)
+		if err == nil {
+			t.Fatalf("expected an error writing %#v", row)
+		}
+	}
+	err = writer.Write([]any{uint32(1), nil})
+	if err != nil {
+		t.Fatalf("error writing a valid row: %s", err.Error())
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("error closing the writer: %s", err.Error())
+	}
+	err = writer.Write([]any{uint32(1), nil})
+	if err == nil {
+		t.Fatalf("expected an error writing to a closed writer")
+	}
+}
+
+// goldenRow returns row i of the golden files written by testdata/parquet-go
+func goldenRow(i int) []any {
+	var note, fee any
+	if i%4 != 0 {
+		note = fmt.Sprintf("note %d", i)
+	}
+	if i%7 != 3 {
+		fee = int64(i) * 3
+	}
+	return []any{
+		uint32(4_000_000_000 + i),
+		i%3 == 0,
+		int64(i) * -1_000_000_007,
+		uint8(i * 7),
+		math.MaxUint64 - uint64(i),
+		float64(i) / 4,
+		float64(i) / 8,
+		fmt.Sprintf("farmer-%d", i%5),
+		note,
+		fee,
+		int32(-i),
+		time.UnixMilli(1_700_000_000_000 + int64(i)*1500),
+		time.UnixMicro(1_700_000_000_000_000 + int64(i)*1_000_001),
+	}
+}
+
+// TestReadParquetGo checks files from another writer are read. They have several row groups of snappy or gzip
+// compressed pages, FLOAT and millisecond timestamp columns, and a dictionary encoded column
+func TestReadParquetGo(t *testing.T) {
+	columns := []Column{
+		{Name: "height", Kind: Uint32},
+		{Name: "flag", Kind: Boolean},
+		{Name: "count", Kind: Int64},
+		{Name: "small", Kind: Uint8},
+		{Name: "big", Kind: Uint64},
+		{Name: "price", Kind: Double},
+		{Name: "ratio", Kind: Double},
+		{Name: "farmer", Kind: String},
+		{Name: "note", Kind: String, Optional: true},
+		{Name: "fee", Kind: Int64, Optional: true},
+		{Name: "delta", Kind: Int32},
+		{Name: "millis", Kind: Timestamp},
+		{Name: "micros", Kind: Timestamp},
+	}
+	const rows = 500
+
+	for _, name := range []string{"parquet-go-snappy.parquet", "parquet-go-gzip.parquet"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatalf("error reading the golden file: %s", err.Error())
+			}
+			reader, err := NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("error opening the reader: %s", err.Error())
+			}
+			defer reader.Close()
+
+			if len(reader.groups) < 2 {
+				t.Fatalf("file has %d row groups, want several", len(reader.groups))
+			}
+			if reader.NumRows() != rows {
+				t.Fatalf("file has %d rows, want %d", reader.NumRows(), rows)
+			}
+			if fmt.Sprint(reader.Columns()) != fmt.Sprint(columns) {
+				t.Fatalf("columns are %v, want %v", reader.Columns(), columns)
+			}
+			if reader.Metadata()["source"] != "golden" {
+				t.Fatalf("metadata is %v, want source golden", reader.Metadata())
+			}
+
+			for i := 0; i < rows; i++ {
+				row, err := reader.Read()
+				if err != nil {
+					t.Fatalf("error reading row %d: %s", i, err.Error())
+				}
+				checkRow(t, i, row, goldenRow(i), columns)
+			}
+			_, err = reader.Read()
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("expected io.EOF after the last row, got %v", err)
+			}
+		})
+	}
+}
+
+// TestDecodeHybrid checks bit packed and RLE runs are decoded, using the example from the Parquet encodings spec
+func TestDecodeHybrid(t *testing.T) {
+	// A bit packed run of 0 to 7 with a bit width of 3, then an RLE run of five 6s
+	data := []byte{1<<1 | 1, 0b10001000, 0b11000110, 0b11111010, 5 << 1, 6}
+	want := []uint32{0, 1, 2, 3, 4, 5, 6, 7, 6, 6, 6, 6, 6}
+
+	got, err := decodeHybrid(data, 3, len(want))
+	if err != nil {
+		t.Fatalf("error decoding: %s", err.Error())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("decoded %v, want %v", got, want)
+	}
+
+	_, err = decodeHybrid(data, 3, len(want)+1)
+	if err == nil {
+		t.Fatalf("expected an error decoding more values than the data has")
+	}
+}
+
+// TestReadErrors checks truncated and corrupted files are refused instead of read
+func TestReadErrors(t *testing.T) {
+	var file bytes.Buffer
+	writer, err := NewWriter(&file, allKinds, nil)
+	if err != nil {
+		t.Fatalf("error creating the writer: %s", err.Error())
+	}
+	for i := 0; i < 100; i++ {
+		err = writer.Write(allKindsRow(i))
+		if err != nil {
+			t.Fatalf("error writing row %d: %s", i, err.Error())
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("error closing the writer: %s", err.Error())
+	}
+	data := file.Bytes()
+
+	// A file that wasn't closed doesn't have a footer
+	truncated := data[:len(data)/2]
+	_, err = NewReader(bytes.NewReader(truncated), int64(len(truncated)))
+	if err == nil {
+		t.Fatalf("expected an error opening a truncated file")
+	}
+
+	// Corrupting the pages is noticed while reading the rows
+	corrupted := bytes.Clone(data)
+	for i := len(magic); i < len(magic)+64; i++ {
+		corrupted[i] ^= 0xff
+	}
+	reader, err := NewReader(bytes.NewReader(corrupted), int64(len(corrupted)))
+	if err != nil {
+		t.Fatalf("error opening the reader: %s", err.Error())
+	}
+	defer reader.Close()
+	_, err = reader.Read()
+	if err == nil {
+		t.Fatalf("expected an error reading corrupted pages")
+	}
+}
@@ -0,0 +1,526 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Reader reads the rows of a Parquet file, a row group at a time
+type Reader struct {
+	input    io.ReaderAt
+	size     int64
+	columns  []Column
+	leaves   []leaf
+	metadata map[string]string
+	numRows  int64
+	groups   []rowGroup
+	decoder  *zstd.Decoder
+
+	// group is the index of the next row group to load, and values are the values of each column of the loaded group
+	group  int
+	values [][]any
+	row    int
+}
+
+// leaf is how the values of a column are stored
+type leaf struct {
+	column   Column
+	physical int32
+	unit     time.Duration
+}
+
+// NewReader reads the footer of the file, which is size bytes long
+func NewReader(input io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, errors.New("file is too short to be a Parquet file")
+	}
+	head := make([]byte, len(magic))
+	_, err := input.ReadAt(head, 0)
+	if err != nil {
+		return nil, err
+	}
+	tail := make([]byte, 4+len(magic))
+	_, err = input.ReadAt(tail, size-int64(len(tail)))
+	if err != nil {
+		return nil, err
+	}
+	if !Magic(head) || !Magic(tail[4:]) {
+		return nil, errors.New("not a Parquet file")
+	}
+
+	footerSize := int64(binary.LittleEndian.Uint32(tail))
+	if footerSize > size-int64(2*len(magic)+4) {
+		return nil, errors.New("invalid footer length")
+	}
+	footer := make([]byte, footerSize)
+	_, err = input.ReadAt(footer, size-int64(len(tail))-footerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	thrift := thriftReader{data: footer}
+	meta := readFileMetaData(&thrift)
+	if thrift.err != nil {
+		return nil, thrift.err
+	}
+
+	if len(meta.schema) < 2 || int(meta.schema[0].numChildren) != len(meta.schema)-1 {
+		return nil, errors.New("only files with flat columns are supported")
+	}
+	r := &Reader{input: input, size: size, numRows: meta.numRows, groups: meta.rowGroups, metadata: map[string]string{}}
+	for _, element := range meta.schema[1:] {
+		if element.numChildren > 0 || !element.hasType {
+			return nil, fmt.Errorf("column %s is nested, which isn't supported", element.name)
+		}
+		column, unit, err := columnFromSchema(element)
+		if err != nil {
+			return nil, err
+		}
+		r.columns = append(r.columns, column)
+		r.leaves = append(r.leaves, leaf{column: column, physical: element.typ, unit: unit})
+	}
+	for _, group := range r.groups {
+		if len(group.columns) != len(r.columns) {
+			return nil, fmt.Errorf("row group has %d columns, but the schema has %d", len(group.columns), len(r.columns))
+		}
+	}
+	for _, kv := range meta.keyValues {
+		r.metadata[kv.key] = kv.value
+	}
+
+	r.decoder, err = zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Columns returns the columns of the file
+func (r *Reader) Columns() []Column {
+	return r.columns
+}
+
+// Metadata returns the key value metadata of the file
+func (r *Reader) Metadata() map[string]string {
+	return r.metadata
+}
+
+// NumRows returns the number of rows in the file
+func (r *Reader) NumRows() int64 {
+	return r.numRows
+}
+
+// Read returns the next row, with a value for each column, or io.EOF after the last row
+func (r *Reader) Read() ([]any, error) {
+	for len(r.values) == 0 || r.row >= len(r.values[0]) {
+		if r.group >= len(r.groups) {
+			return nil, io.EOF
+		}
+		err := r.loadGroup(r.groups[r.group])
+		if err != nil {
+			return nil, err
+		}
+		r.group++
+		r.row = 0
+	}
+
+	row := make([]any, len(r.values))
+	for i := range r.values {
+		row[i] = r.values[i][r.row]
+	}
+	r.row++
+	return row, nil
+}
+
+// Close releases the resources of the reader. It doesn't close the input
+func (r *Reader) Close() error {
+	r.decoder.Close()
+	return nil
+}
+
+// loadGroup reads the values of every column of the row group
+func (r *Reader) loadGroup(group rowGroup) error {
+	r.values = make([][]any, len(r.leaves))
+	for i, leaf := range r.leaves {
+		chunk := group.columns[i]
+		if len(chunk.path) != 1 || chunk.path[0] != leaf.column.Name {
+			return fmt.Errorf("row group column %v doesn't match the schema column %s", chunk.path, leaf.column.Name)
+		}
+
+		values, err := r.readChunk(leaf, chunk)
+		if err != nil {
+			return fmt.Errorf("error reading column %s: %w", leaf.column.Name, err)
+		}
+		if int64(len(values)) != group.numRows {
+			return fmt.Errorf("column %s has %d values for %d rows", leaf.column.Name, len(values), group.numRows)
+		}
+		r.values[i] = values
+	}
+	return nil
+}
+
+// readChunk reads the pages of a column chunk
+func (r *Reader) readChunk(leaf leaf, chunk columnChunk) ([]any, error) {
+	start := chunk.dataPageOffset
+	if chunk.hasDictionaryPage && chunk.dictionaryPageOffset > 0 && chunk.dictionaryPageOffset < start {
+		start = chunk.dictionaryPageOffset
+	}
+	if start < int64(len(magic)) || chunk.totalCompressedSize < 0 || chunk.totalCompressedSize > r.size-start {
+		return nil, errors.New("column chunk is outside the file")
+	}
+	if chunk.numValues < 0 {
+		return nil, errors.New("invalid number of values")
+	}
+
+	data := make([]byte, chunk.totalCompressedSize)
+	_, err := r.input.ReadAt(data, start)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, 0, min(chunk.numValues, pageRows*groupPages))
+	var dictionary []any
+	for int64(len(values)) < chunk.numValues {
+		thrift := thriftReader{data: data}
+		header := readPageHeader(&thrift)
+		if thrift.err != nil {
+			return nil, thrift.err
+		}
+		data = data[thrift.pos:]
+		if header.compressedSize < 0 || int(header.compressedSize) > len(data) || header.uncompressedSize < 0 {
+			return nil, errors.New("page is outside the column chunk")
+		}
+		page := data[:header.compressedSize]
+		data = data[header.compressedSize:]
+
+		switch header.typ {
+		case pageDictionary:
+			if !header.hasDictionaryInfo {
+				return nil, errors.New("dictionary page without a header")
+			}
+			page, err = r.decompress(chunk.codec, page, int(header.uncompressedSize))
+			if err != nil {
+				return nil, err
+			}
+			dictionary, _, err = decodePlain(leaf, page, int(header.numValues))
+			if err != nil {
+				return nil, err
+			}
+		case pageData, pageDataV2:
+			if !header.hasDataHeader {
+				return nil, errors.New("data page without a header")
+			}
+			if int64(header.numValues) > chunk.numValues-int64(len(values)) {
+				return nil, errors.New("page has more values than the column chunk")
+			}
+			values, err = r.readDataPage(leaf, chunk.codec, header, page, dictionary, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// readDataPage appends the values of a data page
+func (r *Reader) readDataPage(leaf leaf, codec int32, header pageHeader, page []byte, dictionary []any, values []any) ([]any, error) {
+	count := int(header.numValues)
+	if count < 0 {
+		return nil, errors.New("invalid number of values")
+	}
+
+	var err error
+	var levels []byte
+	if header.typ == pageDataV2 {
+		levelsSize := int(header.repetitionLength) + int(header.definitionLength)
+		if header.repetitionLength < 0 || header.definitionLength < 0 || levelsSize > len(page) {
+			return nil, errors.New("invalid levels length")
+		}
+		levels = page[header.repetitionLength:levelsSize]
+		page = page[levelsSize:]
+		if header.compressed {
+			page, err = r.decompress(codec, page, int(header.uncompressedSize)-levelsSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		page, err = r.decompress(codec, page, int(header.uncompressedSize))
+		if err != nil {
+			return nil, err
+		}
+		if leaf.column.Optional {
+			if header.definitionEncoding != encodingRLE {
+				return nil, fmt.Errorf("definition level encoding %d isn't supported", header.definitionEncoding)
+			}
+			if len(page) < 4 {
+				return nil, errors.New("missing definition levels")
+			}
+			size := binary.LittleEndian.Uint32(page)
+			if uint64(size) > uint64(len(page)-4) {
+				return nil, errors.New("invalid definition levels length")
+			}
+			levels = page[4 : 4+size]
+			page = page[4+size:]
+		}
+	}
+
+	defined := make([]bool, count)
+	present := count
+	if leaf.column.Optional {
+		definitions, err := decodeHybrid(levels, 1, count)
+		if err != nil {
+			return nil, err
+		}
+		present = 0
+		for i, definition := range definitions {
+			defined[i] = definition == 1
+			if defined[i] {
+				present++
+			}
+		}
+	} else {
+		for i := range defined {
+			defined[i] = true
+		}
+	}
+
+	var decoded []any
+	switch header.encoding {
+	case encodingPlain:
+		decoded, _, err = decodePlain(leaf, page, present)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		decoded, err = decodeDictionary(page, dictionary, present)
+	default:
+		err = fmt.Errorf("encoding %d isn't supported", header.encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next := 0
+	for _, isDefined := range defined {
+		if isDefined {
+			values = append(values, decoded[next])
+			next++
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values, nil
+}
+
+// decompress decompresses a page that is size bytes uncompressed
+func (r *Reader) decompress(codec int32, data []byte, size int) ([]byte, error) {
+	if size < 0 {
+		return nil, errors.New("invalid uncompressed page size")
+	}
+
+	var decompressed []byte
+	var err error
+	switch codec {
+	case codecUncompressed:
+		decompressed = data
+	case codecSnappy:
+		var decodedSize int
+		decodedSize, err = snappy.DecodedLen(data)
+		if err == nil && decodedSize != size {
+			err = errors.New("snappy page has the wrong size")
+		}
+		if err == nil {
+			decompressed, err = snappy.Decode(nil, data)
+		}
+	case codecGzip:
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			decompressed, err = io.ReadAll(io.LimitReader(reader, int64(size)+1))
+		}
+	case codecZstd:
+		decompressed, err = r.decoder.DecodeAll(data, make([]byte, 0, min(size, 1<<24)))
+	default:
+		return nil, fmt.Errorf("compression codec %d isn't supported", codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) != size {
+		return nil, fmt.Errorf("page is %d bytes uncompressed, but the header says %d", len(decompressed), size)
+	}
+	return decompressed, nil
+}
+
+// decodePlain decodes count PLAIN encoded values, returning the rest of the data
+func decodePlain(leaf leaf, data []byte, count int) ([]any, []byte, error) {
+	values := make([]any, 0, count)
+	short := errors.New("page is too short for its values")
+
+	switch leaf.physical {
+	case typeBoolean:
+		if len(data) < (count+7)/8 {
+			return nil, nil, short
+		}
+		for i := 0; i < count; i++ {
+			values = append(values, data[i/8]&(1<<(i%8)) != 0)
+		}
+		return values, data[(count+7)/8:], nil
+	case typeInt32, typeFloat:
+		if len(data)/4 < count {
+			return nil, nil, short
+		}
+		for i := 0; i < count; i++ {
+			value := binary.LittleEndian.Uint32(data[4*i:])
+			switch leaf.column.Kind {
+			case Uint8:
+				values = append(values, uint8(value))
+			case Uint32:
+				values = append(values, value)
+			case Double:
+				values = append(values, float64(math.Float32frombits(value)))
+			default:
+				values = append(values, int32(value))
+			}
+		}
+		return values, data[4*count:], nil
+	case typeInt64, typeDouble:
+		if len(data)/8 < count {
+			return nil, nil, short
+		}
+		for i := 0; i < count; i++ {
+			value := binary.LittleEndian.Uint64(data[8*i:])
+			switch leaf.column.Kind {
+			case Uint64:
+				values = append(values, value)
+			case Double:
+				values = append(values, math.Float64frombits(value))
+			case Timestamp:
+				values = append(values, timestamp(int64(value), leaf.unit))
+			default:
+				values = append(values, int64(value))
+			}
+		}
+		return values, data[8*count:], nil
+	case typeByteArray:
+		for i := 0; i < count; i++ {
+			if len(data) < 4 {
+				return nil, nil, short
+			}
+			size := binary.LittleEndian.Uint32(data)
+			if uint64(size) > uint64(len(data)-4) {
+				return nil, nil, short
+			}
+			values = append(values, string(data[4:4+size]))
+			data = data[4+size:]
+		}
+		return values, data, nil
+	default:
+		return nil, nil, fmt.Errorf("physical type %d isn't supported", leaf.physical)
+	}
+}
+
+// timestamp returns the time of a value in the unit since the Unix epoch
+func timestamp(value int64, unit time.Duration) time.Time {
+	switch unit {
+	case time.Millisecond:
+		return time.UnixMilli(value).UTC()
+	case time.Microsecond:
+		return time.UnixMicro(value).UTC()
+	default:
+		return time.Unix(0, value).UTC()
+	}
+}
+
+// decodeDictionary decodes count dictionary indices, which are a bit width followed by RLE and bit packed runs
+func decodeDictionary(data []byte, dictionary []any, count int) ([]any, error) {
+	if dictionary == nil {
+		return nil, errors.New("dictionary encoded page without a dictionary page")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if len(data) == 0 {
+		return nil, errors.New("missing dictionary index bit width")
+	}
+
+	indexes, err := decodeHybrid(data[1:], int(data[0]), count)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, count)
+	for i, index := range indexes {
+		if int(index) >= len(dictionary) {
+			return nil, fmt.Errorf("dictionary index %d is out of range", index)
+		}
+		values[i] = dictionary[index]
+	}
+	return values, nil
+}
+
+// decodeHybrid decodes count values of the RLE and bit packed hybrid encoding
+func decodeHybrid(data []byte, bitWidth int, count int) ([]uint32, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return nil, fmt.Errorf("invalid bit width %d", bitWidth)
+	}
+	short := errors.New("RLE data is too short for its values")
+	valueBytes := (bitWidth + 7) / 8
+
+	values := make([]uint32, 0, count)
+	for len(values) < count {
+		header, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, short
+		}
+		data = data[n:]
+
+		if header&1 == 0 {
+			// An RLE run of a value
+			run := header >> 1
+			if len(data) < valueBytes {
+				return nil, short
+			}
+			var value uint32
+			for i := 0; i < valueBytes; i++ {
+				value |= uint32(data[i]) << (8 * i)
+			}
+			data = data[valueBytes:]
+			for i := uint64(0); i < run && len(values) < count; i++ {
+				values = append(values, value)
+			}
+			continue
+		}
+
+		// Groups of 8 bit packed values, least significant bit first
+		groups := header >> 1
+		if groups > uint64(len(data)) {
+			return nil, short
+		}
+		size := int(groups) * bitWidth
+		if size > len(data) {
+			return nil, short
+		}
+		packed := data[:size]
+		data = data[size:]
+		for i := 0; i < int(groups)*8 && len(values) < count; i++ {
+			var value uint32
+			for bit := 0; bit < bitWidth; bit++ {
+				position := i*bitWidth + bit
+				if packed[position/8]&(1<<(position%8)) != 0 {
+					value |= 1 << bit
+				}
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
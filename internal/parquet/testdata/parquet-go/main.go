@@ -0,0 +1,94 @@
+//go:build ignore
+
+// Writes the golden files, which are read by TestReadParquetGo, with another writer, github.com/xitongsys/parquet-go
+// v1.6.2. Run it from a module that requires parquet-go, with the testdata directory as the working directory
+// The rows are the same as goldenRow in the tests. The files have a dictionary encoded column, optional columns, and
+// small pages and row groups, so there are several of each
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type row struct {
+	Height int32   `parquet:"name=height, type=INT32, convertedtype=UINT_32"`
+	Flag   bool    `parquet:"name=flag, type=BOOLEAN"`
+	Count  int64   `parquet:"name=count, type=INT64"`
+	Small  int32   `parquet:"name=small, type=INT32, convertedtype=UINT_8"`
+	Big    int64   `parquet:"name=big, type=INT64, convertedtype=UINT_64"`
+	Price  float64 `parquet:"name=price, type=DOUBLE"`
+	Ratio  float32 `parquet:"name=ratio, type=FLOAT"`
+	Farmer string  `parquet:"name=farmer, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Note   *string `parquet:"name=note, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Fee    *int64  `parquet:"name=fee, type=INT64, repetitiontype=OPTIONAL"`
+	Delta  int32   `parquet:"name=delta, type=INT32"`
+	Millis int64   `parquet:"name=millis, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Micros int64   `parquet:"name=micros, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+const rows = 500
+
+func main() {
+	for name, codec := range map[string]parquet.CompressionCodec{
+		"parquet-go-snappy.parquet": parquet.CompressionCodec_SNAPPY,
+		"parquet-go-gzip.parquet":   parquet.CompressionCodec_GZIP,
+	} {
+		err := write(name, codec)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+	}
+}
+
+func write(name string, codec parquet.CompressionCodec) error {
+	file, err := local.NewLocalFileWriter(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pw, err := writer.NewParquetWriter(file, new(row), 1)
+	if err != nil {
+		return err
+	}
+	pw.PageSize = 1024
+	pw.RowGroupSize = 8 * 1024
+	pw.CompressionType = codec
+	value := "golden"
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{Key: "source", Value: &value})
+
+	for i := 0; i < rows; i++ {
+		r := row{
+			Height: int32(uint32(4_000_000_000 + i)),
+			Flag:   i%3 == 0,
+			Count:  int64(i) * -1_000_000_007,
+			Small:  int32(uint8(i * 7)),
+			Big:    int64(^uint64(0) - uint64(i)),
+			Price:  float64(i) / 4,
+			Ratio:  float32(i) / 8,
+			Farmer: fmt.Sprintf("farmer-%d", i%5),
+			Delta:  int32(-i),
+			Millis: 1_700_000_000_000 + int64(i)*1500,
+			Micros: 1_700_000_000_000_000 + int64(i)*1_000_001,
+		}
+		if i%4 != 0 {
+			note := fmt.Sprintf("note %d", i)
+			r.Note = &note
+		}
+		if i%7 != 3 {
+			fee := int64(i) * 3
+			r.Fee = &fee
+		}
+		err = pw.Write(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteStop()
+}
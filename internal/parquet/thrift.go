@@ -0,0 +1,290 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The Parquet metadata is serialized with the Thrift compact protocol. These are the compact protocol type ids
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// maxThriftDepth is how deeply structs and containers can be nested, so a corrupt file can't exhaust the stack
+const maxThriftDepth = 64
+
+// thriftWriter serializes structs with the Thrift compact protocol
+// Field ids are written as a delta from the previous field in the same struct, so the last id of each struct being
+// written is kept on a stack
+type thriftWriter struct {
+	buf  []byte
+	last []int16
+}
+
+// structBegin starts a struct that is a list element, or the top level struct
+func (w *thriftWriter) structBegin() {
+	w.last = append(w.last, 0)
+}
+
+// structEnd ends the struct started by structBegin or fieldStruct
+func (w *thriftWriter) structEnd() {
+	w.buf = append(w.buf, thriftStop)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) fieldStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+}
+
+func (w *thriftWriter) fieldBool(id int16, value bool) {
+	if value {
+		w.fieldHeader(id, thriftTrue)
+	} else {
+		w.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (w *thriftWriter) fieldByte(id int16, value int8) {
+	w.fieldHeader(id, thriftByte)
+	w.buf = append(w.buf, byte(value))
+}
+
+func (w *thriftWriter) fieldI32(id int16, value int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(int64(value))
+}
+
+func (w *thriftWriter) fieldI64(id int16, value int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(value)
+}
+
+func (w *thriftWriter) fieldString(id int16, value string) {
+	w.fieldHeader(id, thriftBinary)
+	w.string(value)
+}
+
+// fieldList writes the header of a list field. The caller writes the size elements after it
+func (w *thriftWriter) fieldList(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.buf = binary.AppendUvarint(w.buf, uint64(size))
+	}
+}
+
+func (w *thriftWriter) string(value string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(value)))
+	w.buf = append(w.buf, value...)
+}
+
+// varint writes a zigzag encoded varint, which is how every integer wider than a byte is written
+func (w *thriftWriter) varint(value int64) {
+	w.buf = binary.AppendVarint(w.buf, value)
+}
+
+// thriftReader deserializes structs written with the Thrift compact protocol
+// The first error is kept, and every read after it returns the zero value, so callers only need to check err once
+type thriftReader struct {
+	data  []byte
+	pos   int
+	depth int
+	err   error
+}
+
+func (r *thriftReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("invalid metadata: "+format, args...)
+	}
+}
+
+func (r *thriftReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end at offset %d", r.pos)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("bad varint at offset %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return value
+}
+
+func (r *thriftReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("bad varint at offset %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return value
+}
+
+func (r *thriftReader) i32() int32 {
+	value := r.varint()
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		r.fail("i32 out of range at offset %d", r.pos)
+		return 0
+	}
+	return int32(value)
+}
+
+func (r *thriftReader) i64() int64 {
+	return r.varint()
+}
+
+func (r *thriftReader) string() string {
+	size := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if size > uint64(len(r.data)-r.pos) {
+		r.fail("string longer than the metadata at offset %d", r.pos)
+		return ""
+	}
+	value := string(r.data[r.pos : r.pos+int(size)])
+	r.pos += int(size)
+	return value
+}
+
+// boolValue returns the value of a bool field, which is stored in the field type
+func (r *thriftReader) boolValue(typ byte) bool {
+	return typ == thriftTrue
+}
+
+// readStruct reads the fields of a struct, calling field with the id and type of each one. field must read or skip the
+// value
+func (r *thriftReader) readStruct(field func(id int16, typ byte)) {
+	r.depth++
+	defer func() { r.depth-- }()
+	if r.depth > maxThriftDepth {
+		r.fail("nested too deeply")
+		return
+	}
+
+	var last int16
+	for r.err == nil {
+		header := r.byte()
+		if header == thriftStop {
+			return
+		}
+		typ := header & 0x0f
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.i32())
+		}
+		field(id, typ)
+		last = id
+	}
+}
+
+// readList reads the header of a list, calling elem for each of its elements. elem must read or skip the element
+func (r *thriftReader) readList(elem func(typ byte)) {
+	header := r.byte()
+	typ := header & 0x0f
+	size := uint64(header >> 4)
+	if size == 15 {
+		size = r.uvarint()
+	}
+	// Every element is at least a byte, so a bigger size can only be from a corrupt file
+	if size > uint64(len(r.data)-r.pos) {
+		r.fail("list longer than the metadata at offset %d", r.pos)
+		return
+	}
+	for i := uint64(0); i < size && r.err == nil; i++ {
+		elem(typ)
+	}
+}
+
+// skip reads past a value of the type
+func (r *thriftReader) skip(typ byte) {
+	r.depth++
+	defer func() { r.depth-- }()
+	if r.depth > maxThriftDepth {
+		r.fail("nested too deeply")
+		return
+	}
+
+	switch typ {
+	case thriftTrue, thriftFalse:
+	case thriftByte:
+		r.byte()
+	case thriftI16, thriftI32, thriftI64:
+		r.varint()
+	case thriftDouble:
+		for i := 0; i < 8; i++ {
+			r.byte()
+		}
+	case thriftBinary:
+		r.string()
+	case thriftList, thriftSet:
+		r.readList(func(elemType byte) {
+			// Bools in containers are a byte each, rather than being in the type
+			if elemType == thriftTrue || elemType == thriftFalse {
+				r.byte()
+				return
+			}
+			r.skip(elemType)
+		})
+	case thriftMap:
+		size := r.uvarint()
+		if size == 0 {
+			return
+		}
+		types := r.byte()
+		for i := uint64(0); i < size && r.err == nil; i++ {
+			r.skip(types >> 4)
+			r.skip(types & 0x0f)
+		}
+	case thriftStruct:
+		r.readStruct(func(id int16, typ byte) {
+			r.skip(typ)
+		})
+	default:
+		r.fail("unknown type %d at offset %d", typ, r.pos)
+	}
+}
@@ -0,0 +1,351 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// pageRows is the number of rows in each page
+	pageRows = 8192
+
+	// groupPages is the number of pages of each column in a row group
+	groupPages = 8
+)
+
+// Writer writes rows to a Parquet file
+// Rows are buffered until there are enough for a page, and the pages are kept in memory until there are enough for a
+// row group, which is then written to the output
+type Writer struct {
+	output   io.Writer
+	columns  []Column
+	schema   []schemaElement
+	metadata map[string]string
+	encoder  *zstd.Encoder
+
+	// offset is the number of bytes written to the output
+	offset int64
+
+	// rows are the rows for the next page, and chunks are the pages of each column for the current row group
+	rows      [][]any
+	chunks    []chunkBuffer
+	groupRows int64
+
+	groups  []rowGroup
+	numRows int64
+	closed  bool
+}
+
+// chunkBuffer is the pages of a column for the current row group
+type chunkBuffer struct {
+	pages        []byte
+	numValues    int64
+	uncompressed int64
+}
+
+// NewWriter returns a writer for a file with the columns and metadata. Close must be called to finish the file, and it
+// doesn't close the output
+func NewWriter(output io.Writer, columns []Column, metadata map[string]string) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("a file must have at least one column")
+	}
+
+	schema := []schemaElement{{name: "schema", numChildren: int32(len(columns))}}
+	names := map[string]bool{}
+	for _, column := range columns {
+		if column.Name == "" || names[column.Name] {
+			return nil, fmt.Errorf("column name %q is empty or repeated", column.Name)
+		}
+		names[column.Name] = true
+
+		element, err := column.schemaElement()
+		if err != nil {
+			return nil, err
+		}
+		schema = append(schema, element)
+	}
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		output:   output,
+		columns:  columns,
+		schema:   schema,
+		metadata: metadata,
+		encoder:  encoder,
+		chunks:   make([]chunkBuffer, len(columns)),
+	}
+	err = w.write([]byte(magic))
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write adds a row, with a value for each column of the column's kind, or nil for optional columns
+func (w *Writer) Write(row []any) error {
+	if w.closed {
+		return errors.New("write to a closed writer")
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, column := range w.columns {
+		err := checkValue(column, row[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	w.rows = append(w.rows, slices.Clone(row))
+	if len(w.rows) < pageRows {
+		return nil
+	}
+
+	return w.flushPage()
+}
+
+// Close writes any buffered rows and the footer
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.encoder.Close()
+
+	err := w.flushGroup()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(w.metadata))
+	for key := range w.metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	meta := fileMetaData{
+		schema:    w.schema,
+		numRows:   w.numRows,
+		rowGroups: w.groups,
+		createdBy: "block-metrics",
+	}
+	for _, key := range keys {
+		meta.keyValues = append(meta.keyValues, keyValue{key: key, value: w.metadata[key]})
+	}
+
+	var footer thriftWriter
+	meta.write(&footer)
+	footer.buf = binary.LittleEndian.AppendUint32(footer.buf, uint32(len(footer.buf)))
+	footer.buf = append(footer.buf, magic...)
+
+	return w.write(footer.buf)
+}
+
+// flushPage encodes the buffered rows to a page of each column, and writes the row group once it has enough pages
+func (w *Writer) flushPage() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+
+	for i, column := range w.columns {
+		values := make([]any, len(w.rows))
+		for j, row := range w.rows {
+			values[j] = row[i]
+		}
+		w.chunks[i].addPage(w.encoder, column, values)
+	}
+	w.groupRows += int64(len(w.rows))
+	w.rows = w.rows[:0]
+
+	if w.groupRows < pageRows*groupPages {
+		return nil
+	}
+	return w.flushGroup()
+}
+
+// flushGroup writes the buffered pages as a row group
+func (w *Writer) flushGroup() error {
+	err := w.flushPage()
+	if err != nil {
+		return err
+	}
+	if w.groupRows == 0 {
+		return nil
+	}
+
+	group := rowGroup{numRows: w.groupRows}
+	for i, column := range w.columns {
+		chunk := &w.chunks[i]
+		group.columns = append(group.columns, columnChunk{
+			typ:                   w.schema[i+1].typ,
+			encodings:             []int32{encodingPlain, encodingRLE},
+			path:                  []string{column.Name},
+			codec:                 codecZstd,
+			numValues:             chunk.numValues,
+			totalUncompressedSize: chunk.uncompressed,
+			totalCompressedSize:   int64(len(chunk.pages)),
+			dataPageOffset:        w.offset,
+		})
+		group.totalByteSize += chunk.uncompressed
+
+		err = w.write(chunk.pages)
+		if err != nil {
+			return err
+		}
+		*chunk = chunkBuffer{pages: chunk.pages[:0]}
+	}
+
+	w.groups = append(w.groups, group)
+	w.numRows += w.groupRows
+	w.groupRows = 0
+	return nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.output.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// addPage encodes the values to a data page, with the definition levels for optional columns
+func (c *chunkBuffer) addPage(encoder *zstd.Encoder, column Column, values []any) {
+	var data []byte
+	if column.Optional {
+		data = binary.LittleEndian.AppendUint32(data, 0)
+		data = appendDefinitionLevels(data, values)
+		binary.LittleEndian.PutUint32(data, uint32(len(data)-4))
+	}
+	data = appendPlain(data, column.Kind, values)
+
+	compressed := encoder.EncodeAll(data, nil)
+	header := pageHeader{
+		typ:                pageData,
+		uncompressedSize:   int32(len(data)),
+		compressedSize:     int32(len(compressed)),
+		numValues:          int32(len(values)),
+		encoding:           encodingPlain,
+		definitionEncoding: encodingRLE,
+	}
+	var headerWriter thriftWriter
+	header.write(&headerWriter)
+
+	c.pages = append(c.pages, headerWriter.buf...)
+	c.pages = append(c.pages, compressed...)
+	c.numValues += int64(len(values))
+	c.uncompressed += int64(len(headerWriter.buf) + len(data))
+}
+
+// appendDefinitionLevels appends the definition levels of the values, 0 for nil and 1 otherwise, as RLE runs
+func appendDefinitionLevels(data []byte, values []any) []byte {
+	for start := 0; start < len(values); {
+		defined := values[start] != nil
+		end := start + 1
+		for end < len(values) && (values[end] != nil) == defined {
+			end++
+		}
+
+		data = binary.AppendUvarint(data, uint64(end-start)<<1)
+		if defined {
+			data = append(data, 1)
+		} else {
+			data = append(data, 0)
+		}
+		start = end
+	}
+	return data
+}
+
+// appendPlain appends the values that aren't nil with the PLAIN encoding
+func appendPlain(data []byte, kind Kind, values []any) []byte {
+	if kind == Boolean {
+		var bits []byte
+		count := 0
+		for _, value := range values {
+			if value == nil {
+				continue
+			}
+			if count%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if value.(bool) {
+				bits[count/8] |= 1 << (count % 8)
+			}
+			count++
+		}
+		return append(data, bits...)
+	}
+
+	for _, value := range values {
+		switch value := value.(type) {
+		case int32:
+			data = binary.LittleEndian.AppendUint32(data, uint32(value))
+		case uint8:
+			data = binary.LittleEndian.AppendUint32(data, uint32(value))
+		case uint32:
+			data = binary.LittleEndian.AppendUint32(data, value)
+		case int64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(value))
+		case uint64:
+			data = binary.LittleEndian.AppendUint64(data, value)
+		case float64:
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(value))
+		case time.Time:
+			data = binary.LittleEndian.AppendUint64(data, uint64(value.UnixMicro()))
+		case string:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+			data = append(data, value...)
+		}
+	}
+	return data
+}
+
+// checkValue returns an error if the value can't be written to the column
+func checkValue(column Column, value any) error {
+	if value == nil {
+		if column.Optional {
+			return nil
+		}
+		return fmt.Errorf("column %s is required, but the value is nil", column.Name)
+	}
+
+	var ok bool
+	switch column.Kind {
+	case Boolean:
+		_, ok = value.(bool)
+	case Int32:
+		_, ok = value.(int32)
+	case Int64:
+		_, ok = value.(int64)
+	case Uint8:
+		_, ok = value.(uint8)
+	case Uint32:
+		_, ok = value.(uint32)
+	case Uint64:
+		_, ok = value.(uint64)
+	case Double:
+		_, ok = value.(float64)
+	case String:
+		var s string
+		s, ok = value.(string)
+		if ok && int64(len(s)) > math.MaxInt32 {
+			return fmt.Errorf("value of column %s is too long", column.Name)
+		}
+	case Timestamp:
+		_, ok = value.(time.Time)
+	}
+	if !ok {
+		return fmt.Errorf("column %s is %s, but the value is %T", column.Name, column.Kind, value)
+	}
+	return nil
+}